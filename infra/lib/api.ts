@@ -48,6 +48,10 @@ export class Api extends cdk.Stack {
       configItem,
       eventOperations,
     } = config;
+    // nextTokens issued by one container have to be readable by every other
+    if (!config.paginationTokenKey || config.paginationTokenKey.startsWith('<')) {
+      throw new Error('paginationTokenKey must be set in the config, e.g. to the output of openssl rand -base64 32');
+    }
 
     function baseLambdaConfig(target: string) {
       return {
@@ -66,23 +70,40 @@ export class Api extends cdk.Stack {
         }),
         environment: {
           CORS_ALLOW_ORIGIN_HEADER: config.corsAllowOriginHeader,
+          // Comma separated, entries may be wildcard subdomains like https://*.example.com
+          CORS_ALLOWED_ORIGINS: (config.corsAllowedOrigins || []).join(','),
+          // Off by default, credentials are never sent back to a * origin either way
+          CORS_ALLOW_CREDENTIALS: String(config.corsAllowCredentials ?? false),
+          LOG_LEVEL: config.logLevel || 'info',
+          // Dimensions are name=value pairs, FunctionName is used without them
+          METRICS_NAMESPACE: config.metricsNamespace || '',
+          METRICS_DIMENSIONS: config.metricsDimensions || '',
+          // Spans are only exported with an endpoint, e.g. http://localhost:4318 for the ADOT layer's collector
+          OTEL_EXPORTER_OTLP_ENDPOINT: config.otlpEndpoint || '',
+          // Error responses use about:blank as their problem type without it
+          PROBLEM_TYPE_BASE_URL: config.problemTypeBaseUrl || '',
         },
         timeout: cdk.Duration.seconds(5),
+        tracing: lambda.Tracing.ACTIVE,
       }
     }
 
     const authorizerLambda = new lambda.Function(this, 'request-authorizer-lambda', {
         ...baseLambdaConfig('lambdaAuthorizer'),
     });
-    // Use if JWT authorizer
-    // authorizerLambda.addEnvironment('JWKS_URL', jwksUrl);
-    // authorizerLambda.addEnvironment('JWK_ID', jwkId);
+    // The authorizer fails every request until jwksUrl is set
+    authorizerLambda.addEnvironment('JWKS_URL', config.jwksUrl || '');
+    authorizerLambda.addEnvironment('JWT_ISSUER', config.jwtIssuer || '');
+    authorizerLambda.addEnvironment('JWT_AUDIENCE', config.jwtAudience || '');
+    authorizerLambda.addEnvironment('JWT_ALGORITHMS', (config.jwtAlgorithms || ['RS256']).join(','));
+    authorizerLambda.addEnvironment('JWT_CLOCK_SKEW_SECONDS', String(config.jwtClockSkewSeconds ?? 60));
     const authorizer = new apigateway.RequestAuthorizer(
       this,
       'request-authorizer',
       {
         handler: authorizerLambda,
-        resultsCacheTtl: cdk.Duration.seconds(3600),
+        // Keeps expired tokens from being allowed for long off a cached policy
+        resultsCacheTtl: cdk.Duration.seconds(300),
         identitySources: [apigateway.IdentitySource.header('Authorization')]
       },
     );
@@ -100,10 +121,8 @@ export class Api extends cdk.Stack {
         accessLogDestination: new apigateway.LogGroupLogDestination(gatewayLogGroup),
       },
       endpointTypes: [apigateway.EndpointType.REGIONAL],
-      defaultCorsPreflightOptions: {
-        allowOrigins: ['*'],
-        allowCredentials: true,
-      },
+      // Preflight requests are answered by the Lambdas so they can check
+      // origins against the allowlist, see the OPTIONS methods below
       apiKeySourceType: apigateway.ApiKeySourceType.HEADER,
     });
     this.api = restApi;
@@ -167,8 +186,11 @@ export class Api extends cdk.Stack {
     // ************************************************************************
     const createLambda = new lambda.Function(this, 'create', baseLambdaConfig('create'));
     const readLambda = new lambda.Function(this, 'read', baseLambdaConfig('read'));
+    const listLambda = new lambda.Function(this, 'list', baseLambdaConfig('list'));
     const updateLambda = new lambda.Function(this, 'update', baseLambdaConfig('update'));
     const deleteLambda = new lambda.Function(this, 'delete', baseLambdaConfig('delete'));
+    const restoreLambda = new lambda.Function(this, 'restore', baseLambdaConfig('restore'));
+    const historyLambda = new lambda.Function(this, 'history', baseLambdaConfig('history'));
 
     // Uncomment if there are shared environment variables that need to be set
     // [
@@ -182,14 +204,21 @@ export class Api extends cdk.Stack {
 
     // Uncomment if there are one-off environment variables that need to be set
     // createLambda.addEnvironment(oneOffEnvVarName, value);
+    listLambda.addEnvironment('PAGINATION_TOKEN_KEY', config.paginationTokenKey);
+    historyLambda.addEnvironment('PAGINATION_TOKEN_KEY', config.paginationTokenKey);
+    // Deletes are permanent unless a retention period is configured
+    deleteLambda.addEnvironment('SOFT_DELETE_RETENTION_DAYS', `${config.softDeleteRetentionDays || 0}`);
 
     connectDdbToLambdas(
       primaryTable,
       [
         createLambda,
         readLambda,
+        listLambda,
         updateLambda,
         deleteLambda,
+        restoreLambda,
+        historyLambda,
       ],
       ddbEnvVarName,
     );
@@ -201,6 +230,8 @@ export class Api extends cdk.Stack {
     const v1Resource = restApi.root.addResource('v1');
     const entityResource = v1Resource.addResource('entity');
     const entityIdResource = entityResource.addResource('{entityId}');
+    const restoreResource = entityIdResource.addResource('restore');
+    const historyResource = entityIdResource.addResource('history');
 
     // ************************************************************************
     // Add methods
@@ -219,6 +250,19 @@ export class Api extends cdk.Stack {
       },
     );
 
+    entityResource.addMethod(
+      'GET',
+      new apigateway.LambdaIntegration(listLambda, {}),
+      {
+        authorizationType: apigateway.AuthorizationType.CUSTOM,
+        authorizer,
+        requestParameters: {
+          'method.request.querystring.limit': false,
+          'method.request.querystring.nextToken': false,
+        },
+      },
+    );
+
     entityIdResource.addMethod(
       'DELETE',
       new apigateway.LambdaIntegration(deleteLambda, {}),
@@ -250,6 +294,45 @@ export class Api extends cdk.Stack {
       },
     );
 
+    restoreResource.addMethod(
+      'POST',
+      new apigateway.LambdaIntegration(restoreLambda, {}),
+      {
+        authorizationType: apigateway.AuthorizationType.CUSTOM,
+        authorizer,
+      },
+    );
+
+    historyResource.addMethod(
+      'GET',
+      new apigateway.LambdaIntegration(historyLambda, {}),
+      {
+        authorizationType: apigateway.AuthorizationType.CUSTOM,
+        authorizer,
+        requestParameters: {
+          'method.request.querystring.limit': false,
+          'method.request.querystring.nextToken': false,
+        },
+      },
+    );
+
+    // Browsers do not send credentials with preflight requests, so these
+    // can not go through the authorizer
+    [
+      { resource: entityResource, handler: listLambda },
+      { resource: entityIdResource, handler: readLambda },
+      { resource: restoreResource, handler: restoreLambda },
+      { resource: historyResource, handler: historyLambda },
+    ].forEach(({ resource, handler }) => {
+      resource.addMethod(
+        'OPTIONS',
+        new apigateway.LambdaIntegration(handler, {}),
+        {
+          authorizationType: apigateway.AuthorizationType.NONE,
+        },
+      );
+    });
+
     // *************************************************************************
     // Create async Lambdas and connect to SNS
     // *************************************************************************
@@ -26,6 +26,18 @@ export class Tables extends Stack {
       billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
       replicationRegions: [],
     });
+    // Lets every entity be listed without scanning the table
+    primaryTable.addGlobalSecondaryIndex({
+      indexName: 'secondaryId-id-index',
+      partitionKey: {
+        name: 'secondaryId',
+        type: dynamodb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'id',
+        type: dynamodb.AttributeType.STRING,
+      },
+    });
     this.primaryTable = primaryTable;
   }
 }
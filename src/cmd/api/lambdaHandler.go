@@ -0,0 +1,14 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers"
+)
+
+// Serves every entity route from one Lambda, e.g. behind a /{proxy+}
+// resource, instead of one Lambda per route
+func main() {
+	lambda.Start(common.LambdaEventAdapter("", common.NewRouter(handlers.GetRoutes())))
+}
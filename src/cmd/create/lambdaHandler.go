@@ -1,51 +1,12 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
+	"github.com/aws/aws-lambda-go/lambda"
 
 	"github.com/thomasstep/giphy-livechat-api/internal/common"
-	"github.com/thomasstep/giphy-livechat-api/internal/types"
-
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/create"
 )
 
-type BodyStructure struct {
-	Name string `json:"name"`
-}
-
-func lambdaAdapter(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	// requestContext := request.RequestContext
-	// authorizer := requestContext.Authorizer
-	// userId := authorizer["userId"].(string)
-	var body BodyStructure
-	unmarshalErr := json.Unmarshal([]byte(request.Body), &body)
-	if unmarshalErr != nil {
-		panic(unmarshalErr)
-	}
-
-	entityInfo, err := logic(body.Name)
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, err
-	}
-
-	jsonBody, marshalErr := json.Marshal(entityInfo)
-	if marshalErr != nil {
-		return events.APIGatewayProxyResponse{}, marshalErr
-	}
-
-	return events.APIGatewayProxyResponse{
-		StatusCode: 201,
-		Body:       string(jsonBody),
-	}, err
-}
-
-func getLambdaHandler() types.HandlerSignature {
-	wrappedLambdaAdapter := common.LamdbaWrapper(lambdaAdapter)
-	return wrappedLambdaAdapter
-}
-
 func main() {
-	lambda.Start(getLambdaHandler())
+	lambda.Start(common.LambdaEventAdapter(create.Resource, create.GetLambdaHandler()))
 }
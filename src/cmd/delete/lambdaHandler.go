@@ -1,37 +1,12 @@
 package main
 
 import (
-	"context"
+	"github.com/aws/aws-lambda-go/lambda"
 
 	"github.com/thomasstep/giphy-livechat-api/internal/common"
-	"github.com/thomasstep/giphy-livechat-api/internal/types"
-
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/deleteentity"
 )
 
-type ResponseStructure struct {
-	Id string `json:"id"`
-}
-
-func lambdaAdapter(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	entityId := request.PathParameters["entityId"]
-
-	err := logic(entityId)
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, err
-	}
-
-	return events.APIGatewayProxyResponse{
-		StatusCode: 204,
-	}, err
-}
-
-func getLambdaHandler() types.HandlerSignature {
-	wrappedLambdaAdapter := common.LamdbaWrapper(lambdaAdapter)
-	return wrappedLambdaAdapter
-}
-
 func main() {
-	lambda.Start(getLambdaHandler())
+	lambda.Start(common.LambdaEventAdapter(deleteentity.Resource, deleteentity.GetLambdaHandler()))
 }
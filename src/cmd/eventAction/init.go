@@ -1,17 +1,14 @@
 package main
 
 import (
-	"go.uber.org/zap"
-
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
 	configMod "github.com/thomasstep/giphy-livechat-api/internal/common/config"
 )
 
-var logger *zap.Logger
 var config *configMod.ConfigStruct
+var repo adapters.EntityRepository
 
 func init() {
-	logger = zap.NewExample()
-	defer logger.Sync()
-
 	config = configMod.GetConfig()
+	repo = adapters.GetEntityRepository()
 }
@@ -6,21 +6,60 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 
 	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/tracing"
 )
 
-func handleRequest(ctx context.Context, snsEvent events.SNSEvent) {
-	for _, record := range snsEvent.Records {
-		snsRecord := record.SNS
-		snsMessage := snsRecord.Message
-		var message adapters.EventActionEvent
-		unmarshalErr := json.Unmarshal([]byte(snsMessage), &message)
-		if unmarshalErr != nil {
-			logger.Error(unmarshalErr.Error())
+// SNS delivers message attributes as {"Type": ..., "Value": ...} objects
+func messageAttributeCarrier(messageAttributes map[string]interface{}) tracing.HeaderCarrier {
+	carrier := tracing.HeaderCarrier{}
+	for name, attribute := range messageAttributes {
+		if fields, ok := attribute.(map[string]interface{}); ok {
+			if value, ok := fields["Value"].(string); ok {
+				carrier[name] = value
+			}
 		}
+	}
+
+	return carrier
+}
+
+// Continues the trace of the request that published the message
+func handleRecord(ctx context.Context, snsRecord events.SNSEntity) {
+	ctx, span := tracing.StartInvocation(ctx, "eventAction", trace.SpanKindConsumer, messageAttributeCarrier(snsRecord.MessageAttributes),
+		trace.WithAttributes(
+			semconv.FaaSTriggerPubsub,
+			semconv.MessagingMessageID(snsRecord.MessageID),
+		),
+	)
+	defer span.End()
+
+	ctx, logger := common.InvocationLogger(ctx,
+		zap.String("messageId", snsRecord.MessageID),
+	)
+	defer common.FlushLogger(logger)
 
-		logic(message.Entity)
+	var message adapters.EventActionEvent
+	unmarshalErr := json.Unmarshal([]byte(snsRecord.Message), &message)
+	if unmarshalErr != nil {
+		logger.Error(unmarshalErr.Error())
+		tracing.RecordError(span, unmarshalErr)
+		return
+	}
+
+	logic(ctx, repo, message.Entity)
+}
+
+func handleRequest(ctx context.Context, snsEvent events.SNSEvent) {
+	defer tracing.Flush(ctx)
+
+	for _, record := range snsEvent.Records {
+		handleRecord(ctx, record.SNS)
 	}
 }
 
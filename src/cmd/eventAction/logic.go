@@ -1,14 +1,11 @@
 package main
 
 import (
-	"fmt"
-
-	"go.uber.org/zap"
-
+	"context"
 	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
 	"github.com/thomasstep/giphy-livechat-api/internal/types"
 )
 
-func logic(entity *types.Entity) {
+func logic(ctx context.Context, repo adapters.EntityRepository, entity *types.Entity) {
 	// Perform logic
 }
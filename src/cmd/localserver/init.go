@@ -3,6 +3,7 @@ package main
 import (
 	"go.uber.org/zap"
 
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
 	configMod "github.com/thomasstep/giphy-livechat-api/internal/common/config"
 )
 
@@ -10,8 +11,7 @@ var logger *zap.Logger
 var config *configMod.ConfigStruct
 
 func init() {
-	logger = zap.NewExample()
-	defer logger.Sync()
+	logger = common.Logger()
 
 	config = configMod.GetConfig()
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/metrics"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/lambdaAuthorizer"
+)
+
+/*
+ * Serves the API over plain HTTP so it can be tried without deploying. Every
+ * request goes through the lambdaAuthorizer and then the same handler the
+ * matching Lambda runs, using the routes from infra/lib/api.ts.
+ *
+ * Entities are kept in memory unless DYNAMODB_ENDPOINT is set, in which case
+ * the usual DynamoDB adapters talk to that endpoint and PRIMARY_TABLE_NAME.
+ * Likewise any bearer token is accepted unless JWKS_URL is set, which is why
+ * the server only listens on localhost unless told otherwise.
+ *
+ *   go run ./cmd/localserver -addr localhost:8080 -timeout 5s
+ */
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on, e.g. :8080 for every interface")
+	timeout := flag.Duration("timeout", 5*time.Second, "deadline of each invocation, the Lambda timeout in infra/lib/api.ts")
+	flag.Parse()
+
+	if config.DynamodbEndpoint == "" {
+		logger.Info("Using the in-memory store")
+		adapters.SetEntityRepository(adapters.NewMemoryEntityRepository())
+		adapters.SetIdempotencyRepository(adapters.NewMemoryIdempotencyRepository())
+	} else {
+		logger.Info("Using DynamoDB",
+			zap.String("endpoint", config.DynamodbEndpoint),
+			zap.String("table", config.PrimaryTableName),
+		)
+	}
+
+	// Only this process reads the tokens, so any key will do
+	if config.PaginationTokenKey == "" {
+		config.PaginationTokenKey = common.GenerateToken()
+	}
+
+	if config.JwksUrl == "" {
+		logger.Warn("JWKS_URL is not set, ANY bearer token is accepted and every caller gets full access to the store",
+			zap.String("addr", *addr),
+			zap.Bool("loopbackOnly", isLoopback(*addr)),
+		)
+		if !isLoopback(*addr) {
+			logger.Warn("Tokens are not verified and the server is reachable from other hosts, set JWKS_URL or listen on localhost")
+		}
+		lambdaAuthorizer.SetTokenVerifier(unverifiedTokens{})
+	}
+
+	// EMF documents would drown out the request logs and nothing reads them
+	if common.GetEnv("METRICS_DISABLED", "true") == "true" {
+		metrics.SetRecorder(metrics.NoopRecorder{})
+	}
+
+	server := newLocalServer(handlers.GetRoutes(), *timeout)
+
+	logger.Info("Listening", zap.String("addr", *addr))
+	listenErr := http.ListenAndServe(*addr, server)
+	if listenErr != nil {
+		logger.Fatal("Server stopped", zap.Error(listenErr))
+	}
+}
+
+// Whether addr only accepts connections from this machine
+func isLoopback(addr string) bool {
+	host, _, splitErr := net.SplitHostPort(addr)
+	if splitErr != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.uber.org/zap"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/lambdaAuthorizer"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Same as the Lambda invocation payload limit
+const maxBodyBytes = 6 * 1024 * 1024
+
+const localStage = "local"
+
+type localServer struct {
+	routes  []common.Route
+	timeout time.Duration
+}
+
+func newLocalServer(routes []common.Route, timeout time.Duration) *localServer {
+	return &localServer{
+		routes:  routes,
+		timeout: timeout,
+	}
+}
+
+// Preflight requests are matched on the method they ask about and, like on
+// API Gateway, skip the authorizer
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func (s *localServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.Method
+	if isPreflight(r) {
+		method = r.Header.Get("Access-Control-Request-Method")
+	}
+
+	allowedMethods := []string{}
+	for _, candidate := range s.routes {
+		pathParameters, matched := common.MatchResource(candidate.Resource, r.URL.EscapedPath())
+		if !matched {
+			continue
+		}
+		if candidate.Method != method {
+			allowedMethods = append(allowedMethods, candidate.Method)
+			continue
+		}
+
+		s.invoke(w, r, candidate, pathParameters)
+		return
+	}
+
+	if len(allowedMethods) == 0 {
+		writeMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	w.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+	writeMessage(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+}
+
+func (s *localServer) invoke(w http.ResponseWriter, r *http.Request, matched common.Route, pathParameters map[string]string) {
+	requestId := common.GenerateToken()
+	requestLogger := logger.With(
+		zap.String("requestId", requestId),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+	)
+
+	// The Lambda runtime turns a panic into a failed invocation, which API
+	// Gateway reports as a 502
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			requestLogger.Error("Handler panicked", zap.Any("panic", recovered))
+			writeMessage(w, http.StatusBadGateway, "Internal server error")
+		}
+	}()
+
+	body, readErr := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if readErr != nil {
+		writeMessage(w, http.StatusRequestEntityTooLarge, "Request Too Long")
+		return
+	}
+
+	request := toProxyRequest(r, matched.Resource, pathParameters, body, requestId)
+
+	// Each invocation gets a deadline, like in Lambda
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	if !isPreflight(r) {
+		authorizerContext, allowed, authErr := authorize(ctx, request)
+		if authErr != nil {
+			requestLogger.Error("Authorizer failed", zap.Error(authErr))
+			writeMessage(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if !allowed {
+			writeMessage(w, http.StatusForbidden, "User is not authorized to access this resource with an explicit deny")
+			return
+		}
+		request.RequestContext.Authorizer = authorizerContext
+	}
+
+	ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{
+		AwsRequestID: requestId,
+	})
+
+	start := time.Now()
+	res, handlerErr := matched.Handler(ctx, common.NewRequestFromProxy(request))
+	if handlerErr != nil {
+		requestLogger.Error("Handler failed", zap.Error(handlerErr))
+		writeMessage(w, http.StatusBadGateway, "Internal server error")
+		return
+	}
+
+	requestLogger.Info("Handled request",
+		zap.Int("statusCode", res.StatusCode),
+		zap.Duration("duration", time.Since(start)),
+	)
+	writeResponse(w, res)
+}
+
+func toProxyRequest(r *http.Request, resource string, pathParameters map[string]string, body []byte, requestId string) events.APIGatewayProxyRequest {
+	headers := map[string]string{}
+	for name, values := range r.Header {
+		headers[name] = values[len(values)-1]
+	}
+
+	query := r.URL.Query()
+	queryStringParameters := map[string]string{}
+	for name, values := range query {
+		queryStringParameters[name] = values[len(values)-1]
+	}
+
+	return events.APIGatewayProxyRequest{
+		Resource:                        resource,
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         headers,
+		MultiValueHeaders:               r.Header,
+		QueryStringParameters:           queryStringParameters,
+		MultiValueQueryStringParameters: query,
+		PathParameters:                  pathParameters,
+		Body:                            string(body),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:    requestId,
+			Stage:        localStage,
+			ResourcePath: resource,
+			HTTPMethod:   r.Method,
+			Path:         r.URL.Path,
+		},
+	}
+}
+
+// Stands in for the JWKS when there is none to check tokens against
+type unverifiedTokens struct{}
+
+func (unverifiedTokens) Verify(ctx context.Context, token string) (string, error) {
+	return "user", nil
+}
+
+// Runs the lambdaAuthorizer the way API Gateway does and returns the
+// authorizer context handlers see in their request context
+func authorize(ctx context.Context, request events.APIGatewayProxyRequest) (map[string]interface{}, bool, error) {
+	methodArn := fmt.Sprintf("arn:aws:execute-api:%s:000000000000:%s/%s/%s%s",
+		config.Region, localStage, localStage, request.HTTPMethod, request.Path)
+
+	authRes, authErr := lambdaAuthorizer.HandleRequest(ctx, events.APIGatewayCustomAuthorizerRequestTypeRequest{
+		Type:                  "REQUEST",
+		MethodArn:             methodArn,
+		Resource:              request.Resource,
+		Path:                  request.Path,
+		HTTPMethod:            request.HTTPMethod,
+		Headers:               request.Headers,
+		QueryStringParameters: request.QueryStringParameters,
+		PathParameters:        request.PathParameters,
+	})
+	if authErr != nil {
+		return nil, false, authErr
+	}
+
+	allowed := false
+	for _, statement := range authRes.PolicyDocument.Statement {
+		if statement.Effect == "Deny" {
+			return nil, false, nil
+		}
+		if statement.Effect == "Allow" {
+			allowed = true
+		}
+	}
+
+	authorizerContext := map[string]interface{}{
+		"principalId": authRes.PrincipalID,
+	}
+	for key, value := range authRes.Context {
+		authorizerContext[key] = value
+	}
+
+	return authorizerContext, allowed, nil
+}
+
+func writeResponse(w http.ResponseWriter, res types.Response) {
+	for name, value := range res.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range res.MultiValueHeaders {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	for _, cookie := range res.Cookies {
+		w.Header().Add("Set-Cookie", cookie)
+	}
+
+	body := []byte(res.Body)
+	if res.IsBase64Encoded {
+		decoded, decodeErr := base64.StdEncoding.DecodeString(res.Body)
+		if decodeErr != nil {
+			logger.Error("Failed to decode base64 response body", zap.Error(decodeErr))
+			writeMessage(w, http.StatusBadGateway, "Internal server error")
+			return
+		}
+		body = decoded
+	}
+
+	w.WriteHeader(res.StatusCode)
+	w.Write(body)
+}
+
+func writeMessage(w http.ResponseWriter, statusCode int, message string) {
+	jsonBody, _ := json.Marshal(&types.ErrorResponseStructure{
+		Message: message,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(jsonBody)
+}
@@ -1,40 +1,12 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
+	"github.com/aws/aws-lambda-go/lambda"
 
 	"github.com/thomasstep/giphy-livechat-api/internal/common"
-	"github.com/thomasstep/giphy-livechat-api/internal/types"
-
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/read"
 )
 
-func lambdaAdapter(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	entityId := request.PathParameters["entityId"]
-
-	entity, err := logic(entityId)
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, err
-	}
-
-	jsonBody, marshalErr := json.Marshal(entity)
-	if marshalErr != nil {
-		return events.APIGatewayProxyResponse{}, marshalErr
-	}
-
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Body:       string(jsonBody),
-	}, err
-}
-
-func getLambdaHandler() types.HandlerSignature {
-	wrappedLambdaAdapter := common.LamdbaWrapper(lambdaAdapter)
-	return wrappedLambdaAdapter
-}
-
 func main() {
-	lambda.Start(getLambdaHandler())
+	lambda.Start(common.LambdaEventAdapter(read.Resource, read.GetLambdaHandler()))
 }
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/restore"
+)
+
+func main() {
+	lambda.Start(common.LambdaEventAdapter(restore.Resource, restore.GetLambdaHandler()))
+}
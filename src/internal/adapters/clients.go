@@ -3,6 +3,7 @@ package adapters
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfigMod "github.com/aws/aws-sdk-go-v2/config"
@@ -22,7 +23,8 @@ var onceSnsClient sync.Once
 func getAwsConfig() aws.Config {
 	onceAwsConfig.Do(func() {
 		var err error
-		awsConfig, err = awsConfigMod.LoadDefaultConfig(context.TODO())
+		// Loaded once per container, not on behalf of any one invocation
+		awsConfig, err = awsConfigMod.LoadDefaultConfig(context.Background())
 		if err != nil {
 			panic(err)
 		}
@@ -31,14 +33,35 @@ func getAwsConfig() aws.Config {
 	return awsConfig
 }
 
+// callContext bounds a single AWS call by AwsCallTimeout and by the
+// invocation's deadline, less DeadlineReserve so there is still time to
+// answer once the call gives up
+func callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := config.AwsCallTimeout
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		remaining := time.Until(deadline) - config.DeadlineReserve
+		if remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
 func GetDynamodbClient() *dynamodb.Client {
 	onceDdbClient.Do(func() {
 		awsConfig = getAwsConfig()
 
 		region := config.Region
 
+		endpoint := config.DynamodbEndpoint
+
 		dynamodbClient = dynamodb.NewFromConfig(awsConfig, func(opt *dynamodb.Options) {
 			opt.Region = region
+			// Points the client at DynamoDB Local or another compatible server
+			if endpoint != "" {
+				opt.BaseEndpoint = aws.String(endpoint)
+			}
 		})
 	})
 
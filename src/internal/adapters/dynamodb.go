@@ -2,16 +2,23 @@ package adapters
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/metrics"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/tracing"
 	"github.com/thomasstep/giphy-livechat-api/internal/types"
 )
 
@@ -26,52 +33,113 @@ type KeyBasedStruct struct {
 	SecondaryId string `dynamodbav:"secondaryId"`
 }
 
-func ddbPutWrapper(item interface{}, conditionExp *string) (*dynamodb.PutItemOutput, error) {
+// Child span of whatever is in ctx for a single DynamoDB API call
+func startDdbSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "DynamoDB."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.RPCSystemKey.String("aws-api"),
+			semconv.RPCService("DynamoDB"),
+			semconv.RPCMethod(operation),
+			semconv.DBSystemDynamoDB,
+			semconv.AWSDynamoDBTableNames(config.PrimaryTableName),
+		),
+	)
+}
+
+// Records how long a DynamoDB call took and, when it succeeded, the
+// capacity it consumed
+func recordDdbCall(operation string, start time.Time, consumed []ddbtypes.ConsumedCapacity) {
+	dimensions := metrics.Dimensions{
+		"Operation": operation,
+	}
+	metrics.RecordLatency("DynamodbLatency", start, dimensions)
+
+	if len(consumed) == 0 {
+		return
+	}
+	capacityUnits := 0.0
+	for _, capacity := range consumed {
+		capacityUnits += aws.ToFloat64(capacity.CapacityUnits)
+	}
+	metrics.Record("DynamodbConsumedCapacity", capacityUnits, metrics.None, dimensions)
+}
+
+// Single item operations report at most one ConsumedCapacity
+func consumedCapacity(capacity *ddbtypes.ConsumedCapacity) []ddbtypes.ConsumedCapacity {
+	if capacity == nil {
+		return nil
+	}
+
+	return []ddbtypes.ConsumedCapacity{*capacity}
+}
+
+func ddbPutWrapper(ctx context.Context, item interface{}, conditionExp *string) (*dynamodb.PutItemOutput, error) {
 	ddbClient := GetDynamodbClient()
 	av, marshalErr := attributevalue.MarshalMap(item)
 	if marshalErr != nil {
-		logger.Error("Failed to marshal item",
-			zap.Any("item", item),
+		common.LoggerFromContext(ctx).Error("Failed to marshal item",
+			zap.String("itemType", fmt.Sprintf("%T", item)),
 			zap.Error(marshalErr),
 		)
 		return &dynamodb.PutItemOutput{}, marshalErr
 	}
 
-	putItemRes, putItemErr := ddbClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName:           aws.String(config.PrimaryTableName),
-		Item:                av,
-		ConditionExpression: conditionExp,
+	ctx, span := startDdbSpan(ctx, "PutItem")
+	defer span.End()
+	callCtx, cancel := callContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	putItemRes, putItemErr := ddbClient.PutItem(callCtx, &dynamodb.PutItemInput{
+		TableName:              aws.String(config.PrimaryTableName),
+		Item:                   av,
+		ConditionExpression:    conditionExp,
+		ReturnConsumedCapacity: ddbtypes.ReturnConsumedCapacityTotal,
 	})
 	if putItemErr != nil {
-		logger.Error("Failed to put item", zap.Error(putItemErr))
-		return &dynamodb.PutItemOutput{}, putItemErr
+		recordDdbCall("PutItem", start, nil)
+		tracing.RecordError(span, putItemErr)
+		common.LoggerFromContext(ctx).Error("Failed to put item", zap.Error(putItemErr))
+		return &dynamodb.PutItemOutput{}, translateDdbCallErr(ctx, putItemErr)
 	}
+	recordDdbCall("PutItem", start, consumedCapacity(putItemRes.ConsumedCapacity))
 
 	return putItemRes, nil
 }
 
-func ddbGetWrapper(key interface{}, resultItem interface{}) (*dynamodb.GetItemOutput, error) {
+func ddbGetWrapper(ctx context.Context, key interface{}, resultItem interface{}) (*dynamodb.GetItemOutput, error) {
 	ddbClient := GetDynamodbClient()
 	av, marshalErr := attributevalue.MarshalMap(key)
 	if marshalErr != nil {
-		logger.Error("Failed to marshal key",
+		common.LoggerFromContext(ctx).Error("Failed to marshal key",
 			zap.Any("key", key),
 			zap.Error(marshalErr),
 		)
 		return &dynamodb.GetItemOutput{}, marshalErr
 	}
 
-	getItemRes, getItemErr := ddbClient.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String(config.PrimaryTableName),
-		Key:       av,
+	ctx, span := startDdbSpan(ctx, "GetItem")
+	defer span.End()
+	callCtx, cancel := callContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	getItemRes, getItemErr := ddbClient.GetItem(callCtx, &dynamodb.GetItemInput{
+		TableName:              aws.String(config.PrimaryTableName),
+		Key:                    av,
+		ReturnConsumedCapacity: ddbtypes.ReturnConsumedCapacityTotal,
 	})
 	if getItemErr != nil {
-		logger.Error("Failed to get item", zap.Error(getItemErr))
-		return &dynamodb.GetItemOutput{}, getItemErr
+		recordDdbCall("GetItem", start, nil)
+		tracing.RecordError(span, getItemErr)
+		common.LoggerFromContext(ctx).Error("Failed to get item", zap.Error(getItemErr))
+		return &dynamodb.GetItemOutput{}, translateDdbCallErr(ctx, getItemErr)
 	}
+	recordDdbCall("GetItem", start, consumedCapacity(getItemRes.ConsumedCapacity))
 	unmarshalErr := attributevalue.UnmarshalMap(getItemRes.Item, resultItem)
 	if unmarshalErr != nil {
-		logger.Error("Failed to unmarshal item",
+		common.LoggerFromContext(ctx).Error("Failed to unmarshal item",
 			zap.Error(unmarshalErr),
 		)
 		return &dynamodb.GetItemOutput{}, unmarshalErr
@@ -80,13 +148,24 @@ func ddbGetWrapper(key interface{}, resultItem interface{}) (*dynamodb.GetItemOu
 	return getItemRes, nil
 }
 
-func ddbQueryWrapper(key string, limit int32, startKey map[string]ddbtypes.AttributeValue) (*dynamodb.QueryOutput, error) {
+// query picks the table or index and key condition, filter may be nil
+func ddbQueryWrapper(ctx context.Context, query paginationQuery, limit int32, filter *expression.ConditionBuilder, startKey map[string]ddbtypes.AttributeValue) (*dynamodb.QueryOutput, error) {
 	ddbClient := GetDynamodbClient()
 
-	keyExpr := expression.Key("id").Equal(expression.Value(key))
-	expr, builderErr := expression.NewBuilder().WithKeyCondition(keyExpr).Build()
+	keyExpr := expression.Key(query.KeyName).Equal(expression.Value(query.Key))
+	if query.SortKeyPrefix != "" {
+		keyExpr = keyExpr.And(expression.Key("secondaryId").BeginsWith(query.SortKeyPrefix))
+	}
+	if query.SortKey != "" {
+		keyExpr = keyExpr.And(expression.Key("secondaryId").Equal(expression.Value(query.SortKey)))
+	}
+	builder := expression.NewBuilder().WithKeyCondition(keyExpr)
+	if filter != nil {
+		builder = builder.WithFilter(*filter)
+	}
+	expr, builderErr := builder.Build()
 	if builderErr != nil {
-		logger.Error("Failed to build key condition expression",
+		common.LoggerFromContext(ctx).Error("Failed to build key condition expression",
 			zap.Error(builderErr),
 		)
 		return &dynamodb.QueryOutput{}, builderErr
@@ -95,202 +174,548 @@ func ddbQueryWrapper(key string, limit int32, startKey map[string]ddbtypes.Attri
 	queryInput := &dynamodb.QueryInput{
 		TableName:                 aws.String(config.PrimaryTableName),
 		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		Limit:                     aws.Int32(limit),
+		ReturnConsumedCapacity:    ddbtypes.ReturnConsumedCapacityTotal,
+	}
+
+	if query.IndexName != "" {
+		queryInput.IndexName = aws.String(query.IndexName)
 	}
 
 	if len(startKey) != 0 {
 		queryInput.ExclusiveStartKey = startKey
 	}
 
-	queryRes, queryErr := ddbClient.Query(context.TODO(), queryInput)
+	ctx, span := startDdbSpan(ctx, "Query")
+	defer span.End()
+	callCtx, cancel := callContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	queryRes, queryErr := ddbClient.Query(callCtx, queryInput)
 	if queryErr != nil {
-		logger.Error("Failed query", zap.Error(queryErr))
-		return &dynamodb.QueryOutput{}, queryErr
+		recordDdbCall("Query", start, nil)
+		tracing.RecordError(span, queryErr)
+		common.LoggerFromContext(ctx).Error("Failed query", zap.Error(queryErr))
+		return &dynamodb.QueryOutput{}, translateDdbCallErr(ctx, queryErr)
 	}
+	recordDdbCall("Query", start, consumedCapacity(queryRes.ConsumedCapacity))
 
 	return queryRes, nil
 }
 
-func ddbUpdateWrapper(key interface{}, update expression.UpdateBuilder) (*dynamodb.UpdateItemOutput, error) {
+// condition may be nil for an unconditional update
+func ddbUpdateWrapper(ctx context.Context, key interface{}, update expression.UpdateBuilder, condition *expression.ConditionBuilder) (*dynamodb.UpdateItemOutput, error) {
 	ddbClient := GetDynamodbClient()
 	av, marshalErr := attributevalue.MarshalMap(key)
 	if marshalErr != nil {
-		logger.Error("Failed to marshal key",
+		common.LoggerFromContext(ctx).Error("Failed to marshal key",
 			zap.Any("key", key),
 			zap.Error(marshalErr),
 		)
 		return &dynamodb.UpdateItemOutput{}, marshalErr
 	}
 
-	expr, builderErr := expression.NewBuilder().WithUpdate(update).Build()
+	builder := expression.NewBuilder().WithUpdate(update)
+	if condition != nil {
+		builder = builder.WithCondition(*condition)
+	}
+	expr, builderErr := builder.Build()
 	if builderErr != nil {
-		logger.Error("Failed to build update expression",
+		common.LoggerFromContext(ctx).Error("Failed to build update expression",
 			zap.Error(builderErr),
 		)
 		return &dynamodb.UpdateItemOutput{}, builderErr
 	}
 
-	updateItemRes, updateItemErr := ddbClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	ctx, span := startDdbSpan(ctx, "UpdateItem")
+	defer span.End()
+	callCtx, cancel := callContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	updateItemRes, updateItemErr := ddbClient.UpdateItem(callCtx, &dynamodb.UpdateItemInput{
 		TableName:                 aws.String(config.PrimaryTableName),
 		Key:                       av,
 		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		ReturnValues:              ddbtypes.ReturnValueAllNew,
+		ReturnConsumedCapacity:    ddbtypes.ReturnConsumedCapacityTotal,
 	})
 	if updateItemErr != nil {
-		logger.Error("Failed to update item", zap.Error(updateItemErr))
-		return &dynamodb.UpdateItemOutput{}, updateItemErr
+		recordDdbCall("UpdateItem", start, nil)
+		tracing.RecordError(span, updateItemErr)
+		common.LoggerFromContext(ctx).Error("Failed to update item", zap.Error(updateItemErr))
+		return &dynamodb.UpdateItemOutput{}, translateDdbCallErr(ctx, updateItemErr)
 	}
+	recordDdbCall("UpdateItem", start, consumedCapacity(updateItemRes.ConsumedCapacity))
 
 	return updateItemRes, nil
 }
 
-func ddbDeleteWrapper(key interface{}) (*dynamodb.DeleteItemOutput, error) {
+// condition may be nil for an unconditional delete
+func ddbDeleteWrapper(ctx context.Context, key interface{}, condition *expression.ConditionBuilder) (*dynamodb.DeleteItemOutput, error) {
 	ddbClient := GetDynamodbClient()
 	av, marshalErr := attributevalue.MarshalMap(key)
 	if marshalErr != nil {
-		logger.Error("Failed to marshal key",
+		common.LoggerFromContext(ctx).Error("Failed to marshal key",
 			zap.Any("key", key),
 			zap.Error(marshalErr),
 		)
 		return &dynamodb.DeleteItemOutput{}, marshalErr
 	}
 
-	deleteItemRes, deleteItemErr := ddbClient.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
-		TableName: aws.String(config.PrimaryTableName),
-		Key:       av,
-	})
+	deleteItemInput := &dynamodb.DeleteItemInput{
+		TableName:              aws.String(config.PrimaryTableName),
+		Key:                    av,
+		ReturnConsumedCapacity: ddbtypes.ReturnConsumedCapacityTotal,
+	}
+
+	if condition != nil {
+		expr, builderErr := expression.NewBuilder().WithCondition(*condition).Build()
+		if builderErr != nil {
+			common.LoggerFromContext(ctx).Error("Failed to build condition expression",
+				zap.Error(builderErr),
+			)
+			return &dynamodb.DeleteItemOutput{}, builderErr
+		}
+
+		deleteItemInput.ConditionExpression = expr.Condition()
+		deleteItemInput.ExpressionAttributeNames = expr.Names()
+		deleteItemInput.ExpressionAttributeValues = expr.Values()
+	}
+
+	ctx, span := startDdbSpan(ctx, "DeleteItem")
+	defer span.End()
+	callCtx, cancel := callContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	deleteItemRes, deleteItemErr := ddbClient.DeleteItem(callCtx, deleteItemInput)
 	if deleteItemErr != nil {
-		logger.Error("Failed to delete item", zap.Error(deleteItemErr))
-		return &dynamodb.DeleteItemOutput{}, deleteItemErr
+		recordDdbCall("DeleteItem", start, nil)
+		tracing.RecordError(span, deleteItemErr)
+		common.LoggerFromContext(ctx).Error("Failed to delete item", zap.Error(deleteItemErr))
+		return &dynamodb.DeleteItemOutput{}, translateDdbCallErr(ctx, deleteItemErr)
 	}
+	recordDdbCall("DeleteItem", start, consumedCapacity(deleteItemRes.ConsumedCapacity))
 
 	return deleteItemRes, nil
 }
 
-func ddbBulkDeleteWrapper(writeReqs []ddbtypes.WriteRequest) (*dynamodb.BatchWriteItemOutput, error) {
+func ddbBulkDeleteWrapper(ctx context.Context, writeReqs []ddbtypes.WriteRequest) (*dynamodb.BatchWriteItemOutput, error) {
 	ddbClient := GetDynamodbClient()
-	batchDeleteOutput, err := ddbClient.BatchWriteItem(context.TODO(), &dynamodb.BatchWriteItemInput{
+	ctx, span := startDdbSpan(ctx, "BatchWriteItem")
+	defer span.End()
+	callCtx, cancel := callContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	batchDeleteOutput, err := ddbClient.BatchWriteItem(callCtx, &dynamodb.BatchWriteItemInput{
 		RequestItems: map[string][]ddbtypes.WriteRequest{
 			config.PrimaryTableName: writeReqs,
 		},
+		ReturnConsumedCapacity: ddbtypes.ReturnConsumedCapacityTotal,
 	})
-	return batchDeleteOutput, err
+	if err != nil {
+		recordDdbCall("BatchWriteItem", start, nil)
+		tracing.RecordError(span, err)
+		common.LoggerFromContext(ctx).Error("Failed to batch write items", zap.Error(err))
+		return batchDeleteOutput, translateDdbCallErr(ctx, err)
+	}
+	recordDdbCall("BatchWriteItem", start, batchDeleteOutput.ConsumedCapacity)
+
+	return batchDeleteOutput, nil
+}
+
+func ddbTransactWriteWrapper(ctx context.Context, transactItems []ddbtypes.TransactWriteItem) (*dynamodb.TransactWriteItemsOutput, error) {
+	ddbClient := GetDynamodbClient()
+	ctx, span := startDdbSpan(ctx, "TransactWriteItems")
+	defer span.End()
+	callCtx, cancel := callContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	transactRes, transactErr := ddbClient.TransactWriteItems(callCtx, &dynamodb.TransactWriteItemsInput{
+		TransactItems:          transactItems,
+		ReturnConsumedCapacity: ddbtypes.ReturnConsumedCapacityTotal,
+	})
+	if transactErr != nil {
+		recordDdbCall("TransactWriteItems", start, nil)
+		tracing.RecordError(span, transactErr)
+		common.LoggerFromContext(ctx).Error("Failed to write transaction", zap.Error(transactErr))
+		return &dynamodb.TransactWriteItemsOutput{}, translateDdbCallErr(ctx, transactErr)
+	}
+	recordDdbCall("TransactWriteItems", start, transactRes.ConsumedCapacity)
+
+	return transactRes, nil
+}
+
+// One put or delete of a transaction, marshalled by ddbTransactWrite
+type ddbTransactWriteItem struct {
+	item      interface{}
+	deleteKey interface{}
+	condition *expression.ConditionBuilder
+}
+
+func ddbTransactPut(item interface{}, condition *expression.ConditionBuilder) ddbTransactWriteItem {
+	return ddbTransactWriteItem{
+		item:      item,
+		condition: condition,
+	}
+}
+
+func ddbTransactDelete(key interface{}, condition *expression.ConditionBuilder) ddbTransactWriteItem {
+	return ddbTransactWriteItem{
+		deleteKey: key,
+		condition: condition,
+	}
+}
+
+func ddbTransactWrite(ctx context.Context, writes []ddbTransactWriteItem) (*dynamodb.TransactWriteItemsOutput, error) {
+	transactItems := make([]ddbtypes.TransactWriteItem, 0, len(writes))
+	for _, write := range writes {
+		var conditionExp *string
+		var names map[string]string
+		var values map[string]ddbtypes.AttributeValue
+		if write.condition != nil {
+			expr, builderErr := expression.NewBuilder().WithCondition(*write.condition).Build()
+			if builderErr != nil {
+				common.LoggerFromContext(ctx).Error("Failed to build condition expression",
+					zap.Error(builderErr),
+				)
+				return &dynamodb.TransactWriteItemsOutput{}, builderErr
+			}
+			conditionExp = expr.Condition()
+			names = expr.Names()
+			values = expr.Values()
+		}
+
+		if write.deleteKey != nil {
+			av, marshalErr := attributevalue.MarshalMap(write.deleteKey)
+			if marshalErr != nil {
+				common.LoggerFromContext(ctx).Error("Failed to marshal key",
+					zap.Any("key", write.deleteKey),
+					zap.Error(marshalErr),
+				)
+				return &dynamodb.TransactWriteItemsOutput{}, marshalErr
+			}
+
+			transactItems = append(transactItems, ddbtypes.TransactWriteItem{
+				Delete: &ddbtypes.Delete{
+					TableName:                 aws.String(config.PrimaryTableName),
+					Key:                       av,
+					ConditionExpression:       conditionExp,
+					ExpressionAttributeNames:  names,
+					ExpressionAttributeValues: values,
+				},
+			})
+			continue
+		}
+
+		av, marshalErr := attributevalue.MarshalMap(write.item)
+		if marshalErr != nil {
+			common.LoggerFromContext(ctx).Error("Failed to marshal item",
+				zap.String("itemType", fmt.Sprintf("%T", write.item)),
+				zap.Error(marshalErr),
+			)
+			return &dynamodb.TransactWriteItemsOutput{}, marshalErr
+		}
+
+		transactItems = append(transactItems, ddbtypes.TransactWriteItem{
+			Put: &ddbtypes.Put{
+				TableName:                 aws.String(config.PrimaryTableName),
+				Item:                      av,
+				ConditionExpression:       conditionExp,
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		})
+	}
+
+	return ddbTransactWriteWrapper(ctx, transactItems)
+}
+
+// BatchWriteItem accepts at most 25 requests per call
+const maxBatchWriteItems = 25
+const maxBatchWriteAttempts = 5
+const batchWriteBaseBackoff = 50 * time.Millisecond
+
+// Deletes the keys in chunks that fit into a single BatchWriteItem call and
+// retries UnprocessedItems with exponential backoff. The returned slice holds
+// any requests that were still unprocessed after the last attempt.
+func ddbBulkDelete(ctx context.Context, keys []KeyBasedStruct) ([]ddbtypes.WriteRequest, error) {
+	unprocessed := make([]ddbtypes.WriteRequest, 0)
+
+	for start := 0; start < len(keys); start += maxBatchWriteItems {
+		end := start + maxBatchWriteItems
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		writeReqs := make([]ddbtypes.WriteRequest, 0, end-start)
+		for _, key := range keys[start:end] {
+			av, marshalErr := attributevalue.MarshalMap(key)
+			if marshalErr != nil {
+				common.LoggerFromContext(ctx).Error("Failed to marshal key",
+					zap.Any("key", key),
+					zap.Error(marshalErr),
+				)
+				return unprocessed, marshalErr
+			}
+
+			writeReqs = append(writeReqs, ddbtypes.WriteRequest{
+				DeleteRequest: &ddbtypes.DeleteRequest{Key: av},
+			})
+		}
+
+		for attempt := 0; len(writeReqs) != 0; attempt++ {
+			if attempt == maxBatchWriteAttempts {
+				unprocessed = append(unprocessed, writeReqs...)
+				break
+			}
+
+			if attempt > 0 {
+				backoff := batchWriteBaseBackoff << (attempt - 1)
+				jitter := time.Duration(rand.Int63n(int64(backoff)))
+				select {
+				case <-time.After(backoff/2 + jitter/2):
+				case <-ctx.Done():
+					unprocessed = append(unprocessed, writeReqs...)
+					return unprocessed, translateTimeout(ctx, ctx.Err())
+				}
+			}
+
+			batchRes, batchErr := ddbBulkDeleteWrapper(ctx, writeReqs)
+			if batchErr != nil {
+				return unprocessed, batchErr
+			}
+
+			writeReqs = batchRes.UnprocessedItems[config.PrimaryTableName]
+		}
+	}
+
+	return unprocessed, nil
+}
+
+// Deletes every item stored under partitionKey
+func ddbDeletePartition(ctx context.Context, partitionKey string) error {
+	startKey := make(map[string]ddbtypes.AttributeValue)
+	unprocessedCount := 0
+
+	for {
+		queryRes, queryErr := ddbQueryWrapper(ctx, partitionQuery(partitionKey, config.Limit), int32(config.Limit), nil, startKey)
+		if queryErr != nil {
+			return queryErr
+		}
+
+		keys := make([]KeyBasedStruct, 0, len(queryRes.Items))
+		for _, item := range queryRes.Items {
+			key := KeyBasedStruct{}
+			unmarshalErr := attributevalue.UnmarshalMap(item, &key)
+			if unmarshalErr != nil {
+				common.LoggerFromContext(ctx).Error("Failed to unmarshal key from partition",
+					zap.Error(unmarshalErr),
+				)
+				return unmarshalErr
+			}
+			keys = append(keys, key)
+		}
+
+		unprocessed, deleteErr := ddbBulkDelete(ctx, keys)
+		if deleteErr != nil {
+			return deleteErr
+		}
+		unprocessedCount += len(unprocessed)
+
+		if len(queryRes.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = queryRes.LastEvaluatedKey
+	}
+
+	if unprocessedCount != 0 {
+		common.LoggerFromContext(ctx).Error("Items were left behind after deleting partition",
+			zap.String("partitionKey", partitionKey),
+			zap.Int("unprocessedCount", unprocessedCount),
+		)
+		return &types.ServiceUnavailableError{
+			Err:        fmt.Errorf("%d related items could not be deleted, please retry.", unprocessedCount),
+			RetryAfter: throttledRetryAfter,
+		}
+	}
+
+	return nil
 }
 
-func ddbOverwrite(item interface{}) (*dynamodb.PutItemOutput, error) {
-	putItemRes, putItemErr := ddbPutWrapper(item, nil)
+// Sets the ttl attribute of every item stored under partitionKey except the
+// one with skipSortKey, or removes it when ttl is zero. Items deleted in the
+// meantime are left alone instead of being recreated.
+func ddbSetPartitionTtl(ctx context.Context, partitionKey string, skipSortKey string, ttl int64) error {
+	update := expression.Remove(expression.Name("ttl"))
+	if ttl != 0 {
+		update = expression.Set(expression.Name("ttl"), expression.Value(ttl))
+	}
+	stillExists := expression.AttributeExists(expression.Name("id"))
+	startKey := make(map[string]ddbtypes.AttributeValue)
+
+	for {
+		queryRes, queryErr := ddbQueryWrapper(ctx, partitionQuery(partitionKey, config.Limit), int32(config.Limit), nil, startKey)
+		if queryErr != nil {
+			return queryErr
+		}
+
+		for _, item := range queryRes.Items {
+			key := KeyBasedStruct{}
+			unmarshalErr := attributevalue.UnmarshalMap(item, &key)
+			if unmarshalErr != nil {
+				common.LoggerFromContext(ctx).Error("Failed to unmarshal key from partition",
+					zap.Error(unmarshalErr),
+				)
+				return unmarshalErr
+			}
+			if key.SecondaryId == skipSortKey {
+				continue
+			}
+
+			_, updateErr := ddbUpdateWrapper(ctx, &key, update, &stillExists)
+			var conflictErr *types.ConflictError
+			if updateErr != nil && !errors.As(updateErr, &conflictErr) {
+				return updateErr
+			}
+		}
+
+		if len(queryRes.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = queryRes.LastEvaluatedKey
+	}
+
+	return nil
+}
+
+func ddbOverwrite(ctx context.Context, item interface{}) (*dynamodb.PutItemOutput, error) {
+	putItemRes, putItemErr := ddbPutWrapper(ctx, item, nil)
 
 	return putItemRes, putItemErr
 }
 
-func ddbPut(item interface{}) (*dynamodb.PutItemOutput, error) {
-	putItemRes, putItemErr := ddbPutWrapper(item, aws.String("attribute_not_exists(secondaryId)"))
+func ddbPut(ctx context.Context, item interface{}) (*dynamodb.PutItemOutput, error) {
+	putItemRes, putItemErr := ddbPutWrapper(ctx, item, aws.String("attribute_not_exists(secondaryId)"))
 
 	return putItemRes, putItemErr
 }
 
-func ddbGet(key interface{}, resultItem interface{}) (*dynamodb.GetItemOutput, error) {
-	return ddbGetWrapper(key, resultItem)
+func ddbGet(ctx context.Context, key interface{}, resultItem interface{}) (*dynamodb.GetItemOutput, error) {
+	return ddbGetWrapper(ctx, key, resultItem)
 }
 
-// TODO is there a way to genericize the queries?
-// Can't pass []interface{} so each type needs its own function
-func ddbQueryEntitys(key string, limit int, nextToken string) ([]types.Entity, string, error) {
-	entitys := make([]types.Entity, 0)
+// Queries until there is one item more than a page (meaning a nextToken is
+// needed) or the results run out. Limit applies before the filter, so a
+// single call can come back short.
+func ddbQueryPage(ctx context.Context, query paginationQuery, filter *expression.ConditionBuilder, nextToken string) ([]map[string]ddbtypes.AttributeValue, error) {
+	items := make([]map[string]ddbtypes.AttributeValue, 0, query.Limit+1)
 
 	// Make empty map and check in ddb query wrapper if it is empty
 	startKey := make(map[string]ddbtypes.AttributeValue)
 	if nextToken != "" {
-		exclStartString, decErr := base64.StdEncoding.DecodeString(nextToken)
-		if decErr != nil {
-			logger.Error("Failed to decode nextToken base64",
-				zap.Error(decErr),
-			)
-			return entitys, "", decErr
-		}
-
-		entity := &types.DdbPrimaryKey{}
-		jsonErr := json.Unmarshal(exclStartString, entity)
-		if jsonErr != nil {
-			logger.Error("Failed to unmarshal nextToken json",
-				zap.Error(jsonErr),
-			)
-			return entitys, "", jsonErr
+		entity, decodeErr := decodeNextToken(ctx, query, nextToken)
+		if decodeErr != nil {
+			return items, decodeErr
 		}
 
 		marshalledStartKey, marshalErr := attributevalue.MarshalMap(entity)
 		if marshalErr != nil {
-			logger.Error("Failed to marshal entity to map[string]AttributeValue",
+			common.LoggerFromContext(ctx).Error("Failed to marshal entity to map[string]AttributeValue",
 				zap.Error(marshalErr),
 			)
-			return entitys, "", marshalErr
+			return items, marshalErr
 		}
 
 		startKey = marshalledStartKey
 	}
 
-	queryRes, err := ddbQueryWrapper(key, int32(limit), startKey)
+	for {
+		queryRes, err := ddbQueryWrapper(ctx, query, int32(query.Limit+1-len(items)), filter, startKey)
+		if err != nil {
+			return items, err
+		}
+
+		items = append(items, queryRes.Items...)
+
+		if len(items) > query.Limit || len(queryRes.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		startKey = queryRes.LastEvaluatedKey
+	}
+}
+
+// TODO is there a way to genericize the queries?
+// Can't pass []interface{} so each type needs its own function
+func ddbQueryEntitys(ctx context.Context, query paginationQuery, nextToken string) ([]types.Entity, string, error) {
+	// Soft-deleted entities are filtered out
+	notDeleted := expression.AttributeNotExists(expression.Name("deletedTime"))
+	items, err := ddbQueryPage(ctx, query, &notDeleted, nextToken)
 	if err != nil {
-		return entitys, "", err
+		return make([]types.Entity, 0), "", err
 	}
 
-	for _, item := range queryRes.Items {
-		ddbEntity := &types.DdbEntityItem{}
-		unmarshalErr := attributevalue.UnmarshalMap(item, ddbEntity)
+	ddbEntitys := make([]types.DdbEntityItem, 0, len(items))
+	for _, item := range items {
+		ddbEntity := types.DdbEntityItem{}
+		unmarshalErr := attributevalue.UnmarshalMap(item, &ddbEntity)
 		if unmarshalErr != nil {
-			logger.Error("Failed to unmarshal entity from list",
+			common.LoggerFromContext(ctx).Error("Failed to unmarshal entity from list",
 				zap.Error(unmarshalErr),
 			)
 		}
 
-		entity := normalizeDdbEntity(ddbEntity)
-
-		entitys = append(entitys, entity)
+		ddbEntitys = append(ddbEntitys, ddbEntity)
 	}
 
-	if len(queryRes.LastEvaluatedKey) != 0 {
-		lastEvalKey := &types.DdbPrimaryKey{}
-		marshalErr := attributevalue.UnmarshalMap(queryRes.LastEvaluatedKey, lastEvalKey)
-		if marshalErr != nil {
-			logger.Error("Failed to unmarshal map[string]AttributeValue to entity",
-				zap.Error(marshalErr),
-			)
-			return entitys, "", marshalErr
-		}
+	return pageEntitys(ctx, query, ddbEntitys)
+}
+
+func ddbQueryEntityHistory(ctx context.Context, query paginationQuery, nextToken string) ([]types.EntityHistory, string, error) {
+	items, err := ddbQueryPage(ctx, query, nil, nextToken)
+	if err != nil {
+		return make([]types.EntityHistory, 0), "", err
+	}
 
-		lastEvalString, jsonErr := json.Marshal(lastEvalKey)
-		if jsonErr != nil {
-			logger.Error("Failed to marshal last evaluated key json",
-				zap.Error(jsonErr),
+	ddbHistory := make([]types.DdbEntityHistoryItem, 0, len(items))
+	for _, item := range items {
+		ddbHistoryItem := types.DdbEntityHistoryItem{}
+		unmarshalErr := attributevalue.UnmarshalMap(item, &ddbHistoryItem)
+		if unmarshalErr != nil {
+			common.LoggerFromContext(ctx).Error("Failed to unmarshal entity history from list",
+				zap.Error(unmarshalErr),
 			)
-			return entitys, "", jsonErr
 		}
 
-		lastEvalB64 := base64.StdEncoding.EncodeToString([]byte(lastEvalString))
-
-		return entitys, lastEvalB64, nil
+		ddbHistory = append(ddbHistory, ddbHistoryItem)
 	}
 
-	return entitys, "", nil
+	return pageEntityHistory(ctx, query, ddbHistory)
 }
 
-func ddbUpdate(key interface{}, update expression.UpdateBuilder) (*dynamodb.UpdateItemOutput, error) {
-	return ddbUpdateWrapper(key, update)
+func ddbUpdate(ctx context.Context, key interface{}, update expression.UpdateBuilder) (*dynamodb.UpdateItemOutput, error) {
+	return ddbUpdateWrapper(ctx, key, update, nil)
 }
 
-func ddbUpdateAndReturn(key interface{}, update expression.UpdateBuilder, resultItem interface{}) (*dynamodb.UpdateItemOutput, error) {
-	updateOutput, err := ddbUpdateWrapper(key, update)
+func ddbUpdateAndReturn(ctx context.Context, key interface{}, update expression.UpdateBuilder, condition *expression.ConditionBuilder, resultItem interface{}) (*dynamodb.UpdateItemOutput, error) {
+	updateOutput, err := ddbUpdateWrapper(ctx, key, update, condition)
 	if err != nil {
 		return updateOutput, err
 	}
 
 	unmarshalErr := attributevalue.UnmarshalMap(updateOutput.Attributes, resultItem)
 	if unmarshalErr != nil {
-		logger.Error("Failed to unmarshal item",
+		common.LoggerFromContext(ctx).Error("Failed to unmarshal item",
 			zap.Error(unmarshalErr),
 		)
 		return updateOutput, unmarshalErr
@@ -299,6 +724,6 @@ func ddbUpdateAndReturn(key interface{}, update expression.UpdateBuilder, result
 	return updateOutput, nil
 }
 
-func ddbDelete(key interface{}) (*dynamodb.DeleteItemOutput, error) {
-	return ddbDeleteWrapper(key)
+func ddbDelete(ctx context.Context, key interface{}) (*dynamodb.DeleteItemOutput, error) {
+	return ddbDeleteWrapper(ctx, key, nil)
 }
@@ -1,76 +1,249 @@
 package adapters
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	// "go.uber.org/zap"
 
-	"github.com/thomasstep/giphy-livechat-api/internal/common"
 	"github.com/thomasstep/giphy-livechat-api/internal/types"
 )
 
-func CreateEntity(entity types.Entity) error {
-	entityItem := types.DdbEntityItem{
-		Entity:        entity,
+/*
+ * Every entity write reads the current item, applies the change in Go and
+ * then stores the new item together with a history snapshot in a single
+ * transaction that only succeeds if the stored version has not moved. The
+ * rules live in the functions below and each EntityRepository only supplies
+ * an entityStore, so the DynamoDB and in-memory implementations behave the
+ * same way.
+ */
+
+// Unconditional writes are retried this many times when they race another writer
+const maxOptimisticWriteAttempts = 3
+
+type entityStore interface {
+	// Returns an empty item when the entity does not exist
+	getEntityItem(ctx context.Context, key KeyBasedStruct) (*types.DdbEntityItem, error)
+	// Atomically applies change and stores its history snapshot. Fails with a
+	// ConflictError when the stored entity no longer matches current.
+	writeEntityChange(ctx context.Context, key KeyBasedStruct, current *types.DdbEntityItem, change entityChange) error
+	// Removes every other item in the partition, history included
+	deleteEntityChildren(ctx context.Context, entityId string) error
+	// Sets ttl on every item in the partition except the entity itself, or
+	// removes it when ttl is zero
+	expireEntityChildren(ctx context.Context, entityId string, ttl int64) error
+}
+
+type entityChange struct {
+	Operation string
+	// New state of the entity, also used as the history snapshot
+	Item *types.DdbEntityItem
+	// Delete the entity item instead of writing Item
+	Remove bool
+}
+
+func entityKey(entityId string) KeyBasedStruct {
+	return KeyBasedStruct{
+		Id:          entityId,
+		SecondaryId: config.EntitySortKey,
+	}
+}
+
+func newDdbEntityItem(entity types.Entity) types.DdbEntityItem {
+	now := time.Now().Format(time.RFC3339)
+	return types.DdbEntityItem{
+		Entity:      entity,
 		Id:          entity.Id,
 		SecondaryId: config.EntitySortKey,
-		CreatedTime: common.GetIsoString(),
-		UpdatedTime: common.GetIsoString(),
+		CreatedTime: now,
+		UpdatedTime: now,
+		Version:     1,
 	}
+}
+
+// Copies current with the version bumped, ready for the next change
+func nextDdbEntityItem(current *types.DdbEntityItem, now time.Time) *types.DdbEntityItem {
+	next := *current
+	next.UpdatedTime = now.Format(time.RFC3339)
+	next.Version++
+	return &next
+}
+
+func historySortKey(now time.Time, version int) string {
+	// Fixed width so sort keys order chronologically
+	timestamp := now.UTC().Format("2006-01-02T15:04:05.000000000Z")
+	return fmt.Sprintf("%s%s#%010d", config.HistorySortKeyPrefix, timestamp, version)
+}
 
-	_, entityPutItemErr := ddbPut(entityItem)
-	if entityPutItemErr != nil {
-		return entityPutItemErr
+func newDdbEntityHistoryItem(change entityChange, now time.Time) types.DdbEntityHistoryItem {
+	return types.DdbEntityHistoryItem{
+		EntityHistory: types.EntityHistory{
+			Operation: change.Operation,
+			Version:   change.Item.Version,
+			Time:      now.Format(time.RFC3339),
+			Entity:    change.Item.Entity,
+		},
+		Id:          change.Item.Id,
+		SecondaryId: historySortKey(now, change.Item.Version),
 	}
+}
 
-	return nil
+func normalizeDdbEntityHistory(ddb *types.DdbEntityHistoryItem) types.EntityHistory {
+	history := ddb.EntityHistory
+	history.Entity.Id = ddb.Id
+	history.Entity.Version = ddb.Version
+	return history
 }
 
 func normalizeDdbEntity(ddb *types.DdbEntityItem) types.Entity {
-	// Reconstruct the entity based on user entity items (see top comment or README)
+	// The partition key is the entity's ID, the sort key only marks the item type
 	entity := ddb.Entity
-	entity.Id = ddb.SecondaryId
+	entity.Id = ddb.Id
+	entity.Version = ddb.Version
+	entity.UpdatedTime = ddb.UpdatedTime
 	return entity
 }
 
-func ReadEntity(entityId string) (*types.Entity, error) {
-	key := &KeyBasedStruct{
-		Id:          entityId,
-		SecondaryId: config.EntitySortKey,
+func missingEntityErr() error {
+	return &types.MissingResourceError{
+		Err: errors.New("Could not find entity."),
 	}
+}
 
-	result := &types.DdbEntityItem{}
-	_, getItemErr := ddbGet(key, result)
+func preconditionFailedErr() error {
+	return &types.PreconditionFailedError{
+		Err: errors.New("Entity has been modified."),
+	}
+}
+
+func isSoftDeleted(ddb *types.DdbEntityItem) bool {
+	return ddb.DeletedTime != ""
+}
+
+// Soft-deleted items stay restorable until DynamoDB's TTL process purges them
+func isRestorable(ddb *types.DdbEntityItem, now time.Time) bool {
+	return isSoftDeleted(ddb) && ddb.Ttl > now.Unix()
+}
+
+// Applies If-Match to the stored entity. Soft-deleted entities count as
+// missing.
+func checkEntityPrecondition(current *types.DdbEntityItem, expectedVersion int) error {
+	if current.Id == "" || isSoftDeleted(current) {
+		if expectedVersion != types.UnconditionalVersion {
+			return preconditionFailedErr()
+		}
+		return missingEntityErr()
+	}
+
+	if expectedVersion >= 0 && current.Version != expectedVersion {
+		return preconditionFailedErr()
+	}
+
+	return nil
+}
+
+func restoreConditionErr(current *types.DdbEntityItem, now time.Time) error {
+	if current.Id == "" || (isSoftDeleted(current) && !isRestorable(current, now)) {
+		return missingEntityErr()
+	}
+
+	return &types.ConflictError{
+		Err: errors.New("Entity is not deleted."),
+	}
+}
+
+// Reads the entity, lets change decide what to write and writes it. Races
+// with other writers are retried unless the caller pinned a version, in which
+// case the client's copy is stale.
+func modifyEntity(ctx context.Context, store entityStore, entityId string, expectedVersion int, change func(current *types.DdbEntityItem, now time.Time) (entityChange, error)) (*types.DdbEntityItem, error) {
+	key := entityKey(entityId)
+
+	for attempt := 1; ; attempt++ {
+		current, getItemErr := store.getEntityItem(ctx, key)
+		if getItemErr != nil {
+			return &types.DdbEntityItem{}, getItemErr
+		}
+
+		now := time.Now()
+		next, changeErr := change(current, now)
+		if changeErr != nil {
+			return &types.DdbEntityItem{}, changeErr
+		}
+
+		writeErr := store.writeEntityChange(ctx, key, current, next)
+		if writeErr == nil {
+			return next.Item, nil
+		}
+
+		var conflictErr *types.ConflictError
+		if !errors.As(writeErr, &conflictErr) {
+			return &types.DdbEntityItem{}, writeErr
+		}
+		if expectedVersion != types.UnconditionalVersion {
+			return &types.DdbEntityItem{}, preconditionFailedErr()
+		}
+		if attempt == maxOptimisticWriteAttempts {
+			return &types.DdbEntityItem{}, writeErr
+		}
+	}
+}
+
+func createEntity(ctx context.Context, store entityStore, entity types.Entity) (*types.Entity, error) {
+	entityItem := newDdbEntityItem(entity)
+
+	writeErr := store.writeEntityChange(ctx, entityKey(entity.Id), &types.DdbEntityItem{}, entityChange{
+		Operation: types.EntityCreated,
+		Item:      &entityItem,
+	})
+	if writeErr != nil {
+		return &types.Entity{}, writeErr
+	}
+
+	createdEntity := normalizeDdbEntity(&entityItem)
+
+	return &createdEntity, nil
+}
+
+func readEntity(ctx context.Context, store entityStore, entityId string) (*types.Entity, error) {
+	result, getItemErr := store.getEntityItem(ctx, entityKey(entityId))
 	if getItemErr != nil {
 		return &types.Entity{}, getItemErr
 	}
 
-	entity := result.Entity
-	entity.Id = result.SecondaryId
+	if isSoftDeleted(result) {
+		return &types.Entity{}, nil
+	}
+
+	entity := normalizeDdbEntity(result)
 
 	return &entity, nil
 }
 
-func UpdateEntity(entityId string, updated types.EntityUpdates, asOwner bool) (*types.Entity, error) {
-	entityKey := &KeyBasedStruct{
-		Id:          entityId,
-		SecondaryId: config.EntitySortKey,
-	}
-
-	var updates expression.UpdateBuilder
-	if updated.Name != "" {
-		updates = updates.Set(
-			expression.Name("name"),
-			expression.Value(updated.Name),
-		)
-	} else {
+func updateEntity(ctx context.Context, store entityStore, entityId string, updated types.EntityUpdates, expectedVersion int) (*types.Entity, error) {
+	if updated.Name == "" {
 		// Nothing to do
 		return &types.Entity{}, nil
 	}
 
-	result := &types.DdbEntityItem{}
-	_, updateItemErr := ddbUpdateAndReturn(entityKey, updates, result)
-	if updateItemErr != nil {
-		return &types.Entity{}, updateItemErr
+	result, updateErr := modifyEntity(ctx, store, entityId, expectedVersion, func(current *types.DdbEntityItem, now time.Time) (entityChange, error) {
+		checkErr := checkEntityPrecondition(current, expectedVersion)
+		if checkErr != nil {
+			return entityChange{}, checkErr
+		}
+
+		next := nextDdbEntityItem(current, now)
+		next.Name = updated.Name
+
+		return entityChange{
+			Operation: types.EntityUpdated,
+			Item:      next,
+		}, nil
+	})
+	if updateErr != nil {
+		return &types.Entity{}, updateErr
 	}
 
 	updatedEntity := normalizeDdbEntity(result)
@@ -78,18 +251,188 @@ func UpdateEntity(entityId string, updated types.EntityUpdates, asOwner bool) (*
 	return &updatedEntity, nil
 }
 
-// Only delete the main entity if the owner is performing the action
-func DeleteEntity(entityId string, asOwner bool) error {
-	entityKey := &KeyBasedStruct{
-		Id:          entityId,
-		SecondaryId: config.EntitySortKey,
+// When config.SoftDeleteRetention is set the entity is only marked deleted
+// and every other item in its partition, history included, gets the
+// entity's TTL, so DynamoDB purges them together once the retention period
+// is over. Deleting it again keeps that TTL. Otherwise the entity item goes first so a failed
+// version check leaves everything in place, then every other item in the
+// partition is removed, history included, so nothing about the entity stays
+// readable. Deletes are idempotent, so retrying after a partial failure
+// finishes the cleanup.
+func deleteEntity(ctx context.Context, store entityStore, entityId string, expectedVersion int) error {
+	softDelete := config.SoftDeleteRetention > 0
+
+	// The entity item's TTL, which its children share
+	var ttl int64
+	_, deleteErr := modifyEntity(ctx, store, entityId, expectedVersion, func(current *types.DdbEntityItem, now time.Time) (entityChange, error) {
+		if isSoftDeleted(current) {
+			// Deleting again must not push the children past the entity
+			ttl = current.Ttl
+		}
+		checkErr := checkEntityPrecondition(current, expectedVersion)
+		if checkErr != nil {
+			return entityChange{}, checkErr
+		}
+
+		next := nextDdbEntityItem(current, now)
+		if softDelete {
+			next.DeletedTime = now.Format(time.RFC3339)
+			next.Ttl = now.Add(config.SoftDeleteRetention).Unix()
+			ttl = next.Ttl
+		}
+
+		return entityChange{
+			Operation: types.EntityDeleted,
+			Item:      next,
+			Remove:    !softDelete,
+		}, nil
+	})
+
+	var missingErr *types.MissingResourceError
+	if deleteErr != nil && !errors.As(deleteErr, &missingErr) {
+		return deleteErr
 	}
 
-	_, deleteUserItemErr := ddbDelete(entityKey)
+	if softDelete {
+		// The entity never existed or was hard-deleted before
+		if ttl == 0 {
+			return nil
+		}
+		return store.expireEntityChildren(ctx, entityId, ttl)
+	}
 
-	if deleteUserItemErr != nil {
-		return deleteUserItemErr
+	return store.deleteEntityChildren(ctx, entityId)
+}
+
+func restoreEntity(ctx context.Context, store entityStore, entityId string) (*types.Entity, error) {
+	current, getItemErr := store.getEntityItem(ctx, entityKey(entityId))
+	if getItemErr != nil {
+		return &types.Entity{}, getItemErr
+	}
+	now := time.Now()
+	if !isRestorable(current, now) {
+		return &types.Entity{}, restoreConditionErr(current, now)
 	}
 
-	return nil
+	// Before the entity, so that a failure here can be retried
+	keepErr := store.expireEntityChildren(ctx, entityId, 0)
+	if keepErr != nil {
+		return &types.Entity{}, keepErr
+	}
+
+	result, restoreErr := modifyEntity(ctx, store, entityId, types.UnconditionalVersion, func(current *types.DdbEntityItem, now time.Time) (entityChange, error) {
+		if !isRestorable(current, now) {
+			return entityChange{}, restoreConditionErr(current, now)
+		}
+
+		next := nextDdbEntityItem(current, now)
+		next.DeletedTime = ""
+		next.Ttl = 0
+
+		return entityChange{
+			Operation: types.EntityRestored,
+			Item:      next,
+		}, nil
+	})
+	if restoreErr != nil {
+		return &types.Entity{}, restoreErr
+	}
+
+	restoredEntity := normalizeDdbEntity(result)
+
+	return &restoredEntity, nil
+}
+
+// DynamodbEntityRepository stores entities in the primary table using the
+// shared DynamoDB client.
+type DynamodbEntityRepository struct{}
+
+var _ EntityRepository = (*DynamodbEntityRepository)(nil)
+
+func NewDynamodbEntityRepository() *DynamodbEntityRepository {
+	return &DynamodbEntityRepository{}
+}
+
+func (r *DynamodbEntityRepository) getEntityItem(ctx context.Context, key KeyBasedStruct) (*types.DdbEntityItem, error) {
+	result := &types.DdbEntityItem{}
+	_, getItemErr := ddbGet(ctx, &key, result)
+	if getItemErr != nil {
+		return &types.DdbEntityItem{}, getItemErr
+	}
+
+	return result, nil
+}
+
+// Condition that the stored entity is still the one the change was based on
+func entityUnchangedCondition(current *types.DdbEntityItem) expression.ConditionBuilder {
+	if current.Id == "" {
+		return expression.AttributeNotExists(expression.Name("secondaryId"))
+	}
+
+	if current.Version == 0 {
+		// Written before entities were versioned
+		return expression.AttributeExists(expression.Name("secondaryId")).And(
+			expression.AttributeNotExists(expression.Name("version")),
+		)
+	}
+
+	return expression.Name("version").Equal(expression.Value(current.Version))
+}
+
+func (r *DynamodbEntityRepository) writeEntityChange(ctx context.Context, key KeyBasedStruct, current *types.DdbEntityItem, change entityChange) error {
+	condition := entityUnchangedCondition(current)
+
+	var entityWrite ddbTransactWriteItem
+	if change.Remove {
+		entityWrite = ddbTransactDelete(&key, &condition)
+	} else {
+		entityWrite = ddbTransactPut(change.Item, &condition)
+	}
+
+	historyCondition := expression.AttributeNotExists(expression.Name("secondaryId"))
+	historyWrite := ddbTransactPut(newDdbEntityHistoryItem(change, time.Now()), &historyCondition)
+
+	_, transactErr := ddbTransactWrite(ctx, []ddbTransactWriteItem{entityWrite, historyWrite})
+	return transactErr
+}
+
+func (r *DynamodbEntityRepository) deleteEntityChildren(ctx context.Context, entityId string) error {
+	return ddbDeletePartition(ctx, entityId)
+}
+
+func (r *DynamodbEntityRepository) expireEntityChildren(ctx context.Context, entityId string, ttl int64) error {
+	return ddbSetPartitionTtl(ctx, entityId, config.EntitySortKey, ttl)
+}
+
+func (r *DynamodbEntityRepository) CreateEntity(ctx context.Context, entity types.Entity) (*types.Entity, error) {
+	return createEntity(ctx, r, entity)
+}
+
+func (r *DynamodbEntityRepository) ReadEntity(ctx context.Context, entityId string) (*types.Entity, error) {
+	return readEntity(ctx, r, entityId)
+}
+
+func (r *DynamodbEntityRepository) UpdateEntity(ctx context.Context, entityId string, updated types.EntityUpdates, expectedVersion int, asOwner bool) (*types.Entity, error) {
+	return updateEntity(ctx, r, entityId, updated, expectedVersion)
+}
+
+// Only delete the main entity if the owner is performing the action
+func (r *DynamodbEntityRepository) DeleteEntity(ctx context.Context, entityId string, expectedVersion int, asOwner bool) error {
+	return deleteEntity(ctx, r, entityId, expectedVersion)
+}
+
+func (r *DynamodbEntityRepository) RestoreEntity(ctx context.Context, entityId string) (*types.Entity, error) {
+	return restoreEntity(ctx, r, entityId)
+}
+
+func (r *DynamodbEntityRepository) QueryEntities(ctx context.Context, key string, limit int, nextToken string) ([]types.Entity, string, error) {
+	return ddbQueryEntitys(ctx, entityQuery(key, limit), nextToken)
+}
+
+func (r *DynamodbEntityRepository) ListEntities(ctx context.Context, limit int, nextToken string) ([]types.Entity, string, error) {
+	return ddbQueryEntitys(ctx, entityIndexQuery(limit), nextToken)
+}
+
+func (r *DynamodbEntityRepository) QueryEntityHistory(ctx context.Context, entityId string, limit int, nextToken string) ([]types.EntityHistory, string, error) {
+	return ddbQueryEntityHistory(ctx, historyQuery(entityId, limit), nextToken)
 }
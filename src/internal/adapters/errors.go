@@ -0,0 +1,116 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Seconds clients are asked to wait after DynamoDB throttles a request
+const throttledRetryAfter = 1
+
+// Seconds clients are asked to wait after a call to AWS timed out
+const timedOutRetryAfter = 1
+
+// translateDdbErr turns DynamoDB SDK errors into the types error hierarchy so
+// ErrorMiddleware can answer with a proper status code. Anything it does not
+// recognize is returned unchanged.
+func translateDdbErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Transactions report why each item failed instead of a single code
+	var canceledErr *ddbtypes.TransactionCanceledException
+	if errors.As(err, &canceledErr) {
+		return translateCancellationReasons(err, canceledErr.CancellationReasons)
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch apiErr.ErrorCode() {
+	case "ConditionalCheckFailedException":
+		return &types.ConflictError{
+			Err:   errors.New("The request conflicts with the current state of the entity."),
+			Cause: err,
+		}
+	case "ProvisionedThroughputExceededException", "RequestLimitExceeded", "ThrottlingException":
+		return &types.ServiceUnavailableError{
+			Err:        errors.New("The service is busy, please retry."),
+			RetryAfter: throttledRetryAfter,
+			Cause:      err,
+		}
+	case "ValidationException":
+		return &types.InternalError{
+			Err: err,
+		}
+	}
+
+	return err
+}
+
+// translateDdbCallErr is translateDdbErr for errors of calls made with a
+// callContext derived from ctx
+func translateDdbCallErr(ctx context.Context, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return translateTimeout(ctx, err)
+	}
+
+	return translateDdbErr(err)
+}
+
+// A call that hit its own timeout while the invocation still had time left
+// is worth retrying. Once the invocation itself runs out of time the request
+// as a whole timed out. Errors other than context.DeadlineExceeded are
+// returned unchanged.
+func translateTimeout(ctx context.Context, err error) error {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline && time.Until(deadline) <= config.DeadlineReserve {
+		return &types.GatewayTimeoutError{
+			Err: err,
+		}
+	}
+
+	return &types.ServiceUnavailableError{
+		Err:        errors.New("The service took too long to respond, please retry."),
+		RetryAfter: timedOutRetryAfter,
+		Cause:      err,
+	}
+}
+
+func translateCancellationReasons(err error, reasons []ddbtypes.CancellationReason) error {
+	for _, reason := range reasons {
+		switch aws.ToString(reason.Code) {
+		case "ConditionalCheckFailed", "TransactionConflict":
+			return &types.ConflictError{
+				Err:   errors.New("The request conflicts with the current state of the entity."),
+				Cause: err,
+			}
+		case "ProvisionedThroughputExceeded", "ThrottlingError", "RequestLimitExceeded":
+			return &types.ServiceUnavailableError{
+				Err:        errors.New("The service is busy, please retry."),
+				RetryAfter: throttledRetryAfter,
+				Cause:      err,
+			}
+		case "ValidationError":
+			return &types.InternalError{
+				Err: err,
+			}
+		}
+	}
+
+	return err
+}
@@ -1,6 +1,7 @@
 package adapters
 
 import (
+	"context"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
 
@@ -12,7 +13,7 @@ type EventActionEvent struct {
 	Updates types.EntityUpdates `json:"updates"`
 }
 
-func EmitEventAction(entity *types.Entity, updates types.EntityUpdates) error {
+func EmitEventAction(ctx context.Context, entity *types.Entity, updates types.EntityUpdates) error {
 	message := &EventActionEvent{
 		Entity:    entity,
 		Updates: updates,
@@ -24,7 +25,7 @@ func EmitEventAction(entity *types.Entity, updates types.EntityUpdates) error {
 		},
 	}
 
-	_, publishErr := snsPublish(message, messageAttributes)
+	_, publishErr := snsPublish(ctx, message, messageAttributes)
 	if publishErr != nil {
 		return publishErr
 	}
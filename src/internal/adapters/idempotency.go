@@ -0,0 +1,183 @@
+package adapters
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"go.uber.org/zap"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+/*
+ * Idempotency-Keys let clients retry a request without repeating its side
+ * effects. The first request with a key claims it for
+ * config.IdempotencyLockTimeout, stores a hash of its body and, once it
+ * succeeds, its response. Retries with the same body get that response
+ * back, retries with a different body are rejected. Keys are purged by the
+ * table's TTL after config.IdempotencyKeyTtl.
+ *
+ * Keys belong to the principal that sent them. Another caller using the
+ * same key claims a key of its own instead of getting the first caller's
+ * response.
+ */
+
+type IdempotencyRepository interface {
+	// Claims key for request. When an earlier request with the same key and
+	// body already finished, its response is returned to be replayed instead.
+	// Otherwise the response is nil and the caller must finish with
+	// CompleteIdempotentRequest or ReleaseIdempotentRequest.
+	StartIdempotentRequest(ctx context.Context, principal string, key string, request interface{}) (*types.IdempotentResponse, error)
+	CompleteIdempotentRequest(ctx context.Context, principal string, key string, response types.IdempotentResponse) error
+	// Frees the key after a failed request so a retry can run it again
+	ReleaseIdempotentRequest(ctx context.Context, principal string, key string) error
+}
+
+var idempotencyRepository IdempotencyRepository
+var onceIdempotencyRepository sync.Once
+
+func GetIdempotencyRepository() IdempotencyRepository {
+	onceIdempotencyRepository.Do(func() {
+		idempotencyRepository = NewDynamodbIdempotencyRepository()
+	})
+
+	return idempotencyRepository
+}
+
+// Replaces the repository GetIdempotencyRepository hands out. Only takes
+// effect before the first call to GetIdempotencyRepository.
+func SetIdempotencyRepository(repo IdempotencyRepository) {
+	onceIdempotencyRepository.Do(func() {
+		idempotencyRepository = repo
+	})
+}
+
+// The principal is hashed so that it has a fixed length and can never run
+// into the key
+func idempotencyItemKey(principal string, key string) KeyBasedStruct {
+	principalHash := sha256.Sum256([]byte(principal))
+	return KeyBasedStruct{
+		Id:          config.IdempotencyKeyPrefix + hex.EncodeToString(principalHash[:]) + "#" + key,
+		SecondaryId: config.IdempotencySortKey,
+	}
+}
+
+func hashIdempotentRequest(ctx context.Context, request interface{}) (string, error) {
+	requestBytes, marshalErr := json.Marshal(request)
+	if marshalErr != nil {
+		common.LoggerFromContext(ctx).Error("Failed to marshal idempotent request",
+			zap.Error(marshalErr),
+		)
+		return "", marshalErr
+	}
+
+	sum := sha256.Sum256(requestBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Whether a new request may claim the stored item. Expired items can linger
+// until the TTL process gets to them.
+func isIdempotencyKeyClaimable(item *types.DdbIdempotencyItem, requestHash string, now time.Time) bool {
+	if item.Id == "" || item.Ttl < now.Unix() {
+		return true
+	}
+
+	// The request holding the key never finished, let an identical retry take over
+	return item.Response == nil && item.RequestHash == requestHash && item.LockExpires < now.Unix()
+}
+
+// Decides what a request gets when it could not claim the stored item
+func idempotencyKeyTakenResponse(item *types.DdbIdempotencyItem, requestHash string) (*types.IdempotentResponse, error) {
+	if item.Id != "" && item.RequestHash != requestHash {
+		return nil, &types.UnprocessableEntityError{
+			Err: errors.New("Idempotency-Key has already been used with a different request."),
+		}
+	}
+
+	if item.Response == nil {
+		return nil, &types.ConflictError{
+			Err: errors.New("A request with this Idempotency-Key is still being processed."),
+		}
+	}
+
+	return item.Response, nil
+}
+
+// DynamodbIdempotencyRepository stores Idempotency-Keys in the primary table.
+type DynamodbIdempotencyRepository struct{}
+
+var _ IdempotencyRepository = (*DynamodbIdempotencyRepository)(nil)
+
+func NewDynamodbIdempotencyRepository() *DynamodbIdempotencyRepository {
+	return &DynamodbIdempotencyRepository{}
+}
+
+func (r *DynamodbIdempotencyRepository) StartIdempotentRequest(ctx context.Context, principal string, key string, request interface{}) (*types.IdempotentResponse, error) {
+	requestHash, hashErr := hashIdempotentRequest(ctx, request)
+	if hashErr != nil {
+		return nil, hashErr
+	}
+
+	itemKey := idempotencyItemKey(principal, key)
+	now := time.Now()
+
+	// Same rules as isIdempotencyKeyClaimable
+	nowValue := expression.Value(now.Unix())
+	condition := expression.Or(
+		expression.AttributeNotExists(expression.Name("secondaryId")),
+		expression.Name("ttl").LessThan(nowValue),
+		expression.And(
+			expression.AttributeNotExists(expression.Name("response")),
+			expression.Name("requestHash").Equal(expression.Value(requestHash)),
+			expression.Name("lockExpires").LessThan(nowValue),
+		),
+	)
+	update := expression.Set(expression.Name("requestHash"), expression.Value(requestHash)).
+		Set(expression.Name("lockExpires"), expression.Value(now.Add(config.IdempotencyLockTimeout).Unix())).
+		Set(expression.Name("ttl"), expression.Value(now.Add(config.IdempotencyKeyTtl).Unix())).
+		Remove(expression.Name("response"))
+
+	_, updateErr := ddbUpdateWrapper(ctx, &itemKey, update, &condition)
+	if updateErr == nil {
+		return nil, nil
+	}
+
+	var conflictErr *types.ConflictError
+	if !errors.As(updateErr, &conflictErr) {
+		return nil, updateErr
+	}
+
+	existing := &types.DdbIdempotencyItem{}
+	_, getItemErr := ddbGet(ctx, &itemKey, existing)
+	if getItemErr != nil {
+		return nil, getItemErr
+	}
+
+	return idempotencyKeyTakenResponse(existing, requestHash)
+}
+
+func (r *DynamodbIdempotencyRepository) CompleteIdempotentRequest(ctx context.Context, principal string, key string, response types.IdempotentResponse) error {
+	itemKey := idempotencyItemKey(principal, key)
+	condition := expression.AttributeExists(expression.Name("secondaryId"))
+	update := expression.Set(expression.Name("response"), expression.Value(response)).
+		Remove(expression.Name("lockExpires"))
+
+	_, updateErr := ddbUpdateWrapper(ctx, &itemKey, update, &condition)
+	return updateErr
+}
+
+func (r *DynamodbIdempotencyRepository) ReleaseIdempotentRequest(ctx context.Context, principal string, key string) error {
+	itemKey := idempotencyItemKey(principal, key)
+	// Never drop a stored response
+	condition := expression.AttributeNotExists(expression.Name("response"))
+
+	_, deleteErr := ddbDeleteWrapper(ctx, &itemKey, &condition)
+	return deleteErr
+}
@@ -0,0 +1,431 @@
+package adapters
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+/*
+ * MemoryEntityRepository is a thread-safe stand-in for the primary table.
+ * Items are kept as marshalled attribute maps keyed by id and secondaryId so
+ * that conditions, returned attributes and pagination line up with what the
+ * DynamoDB implementation does. It is meant for tests and local runs.
+ */
+
+type MemoryEntityRepository struct {
+	mutex sync.RWMutex
+	items map[string]map[string]map[string]ddbtypes.AttributeValue
+}
+
+var _ EntityRepository = (*MemoryEntityRepository)(nil)
+
+func NewMemoryEntityRepository() *MemoryEntityRepository {
+	return &MemoryEntityRepository{
+		items: make(map[string]map[string]map[string]ddbtypes.AttributeValue),
+	}
+}
+
+// Returns what the DynamoDB wrappers return for a failed condition
+func conditionalCheckFailed() error {
+	return translateDdbErr(&ddbtypes.ConditionalCheckFailedException{
+		Message: aws.String("The conditional request failed"),
+	})
+}
+
+// The unexported helpers expect the caller to hold the mutex
+
+func (r *MemoryEntityRepository) itemExists(key KeyBasedStruct) bool {
+	_, exists := r.items[key.Id][key.SecondaryId]
+	return exists
+}
+
+func (r *MemoryEntityRepository) getItem(ctx context.Context, key KeyBasedStruct, resultItem interface{}) error {
+	item, exists := r.items[key.Id][key.SecondaryId]
+	if !exists {
+		// Mirror GetItem, which leaves the result empty instead of erroring
+		return nil
+	}
+
+	unmarshalErr := attributevalue.UnmarshalMap(item, resultItem)
+	if unmarshalErr != nil {
+		common.LoggerFromContext(ctx).Error("Failed to unmarshal item",
+			zap.Error(unmarshalErr),
+		)
+		return unmarshalErr
+	}
+
+	return nil
+}
+
+func (r *MemoryEntityRepository) putItem(ctx context.Context, key KeyBasedStruct, item interface{}) error {
+	av, marshalErr := attributevalue.MarshalMap(item)
+	if marshalErr != nil {
+		common.LoggerFromContext(ctx).Error("Failed to marshal item",
+			zap.Error(marshalErr),
+		)
+		return marshalErr
+	}
+
+	partition, exists := r.items[key.Id]
+	if !exists {
+		partition = make(map[string]map[string]ddbtypes.AttributeValue)
+		r.items[key.Id] = partition
+	}
+	partition[key.SecondaryId] = av
+
+	return nil
+}
+
+func (r *MemoryEntityRepository) deleteItem(key KeyBasedStruct) {
+	partition, exists := r.items[key.Id]
+	if !exists {
+		return
+	}
+
+	delete(partition, key.SecondaryId)
+	if len(partition) == 0 {
+		delete(r.items, key.Id)
+	}
+}
+
+// Mirrors the attribute_not_exists(deletedTime) filter used by queries
+func isSoftDeletedItem(item map[string]ddbtypes.AttributeValue) bool {
+	_, exists := item["deletedTime"]
+	return exists
+}
+
+// Returns up to limit items of query's partition in sort key order starting
+// after startKey, leaving out soft-deleted ones and any item whose sort key
+// does not match the query's SortKeyPrefix or SortKey
+func (r *MemoryEntityRepository) queryItems(query paginationQuery, limit int, startKey *types.DdbPrimaryKey) []map[string]ddbtypes.AttributeValue {
+	partition := r.items[query.Key]
+	sortKeys := make([]string, 0, len(partition))
+	for sortKey, item := range partition {
+		if startKey != nil && sortKey <= startKey.SecondaryId {
+			continue
+		}
+		if !strings.HasPrefix(sortKey, query.SortKeyPrefix) {
+			continue
+		}
+		if query.SortKey != "" && sortKey != query.SortKey {
+			continue
+		}
+		if isSoftDeletedItem(item) {
+			continue
+		}
+		sortKeys = append(sortKeys, sortKey)
+	}
+	sort.Strings(sortKeys)
+
+	items := make([]map[string]ddbtypes.AttributeValue, 0)
+	for _, sortKey := range sortKeys {
+		if len(items) == limit {
+			break
+		}
+		items = append(items, partition[sortKey])
+	}
+
+	return items
+}
+
+// Mirrors a query on the secondary index, which is keyed by secondaryId and
+// sorted by id
+func (r *MemoryEntityRepository) queryIndexItems(secondaryId string, limit int, startKey *types.DdbPrimaryKey) []map[string]ddbtypes.AttributeValue {
+	ids := make([]string, 0)
+	for id, partition := range r.items {
+		item, exists := partition[secondaryId]
+		if !exists || isSoftDeletedItem(item) {
+			continue
+		}
+		if startKey != nil && id <= startKey.Id {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	items := make([]map[string]ddbtypes.AttributeValue, 0)
+	for _, id := range ids {
+		if len(items) == limit {
+			break
+		}
+		items = append(items, r.items[id][secondaryId])
+	}
+
+	return items
+}
+
+func (r *MemoryEntityRepository) pageItems(ctx context.Context, query paginationQuery, items []map[string]ddbtypes.AttributeValue) ([]types.Entity, string, error) {
+	ddbEntitys := make([]types.DdbEntityItem, 0, len(items))
+	for _, item := range items {
+		ddbEntity := types.DdbEntityItem{}
+		unmarshalErr := attributevalue.UnmarshalMap(item, &ddbEntity)
+		if unmarshalErr != nil {
+			common.LoggerFromContext(ctx).Error("Failed to unmarshal entity from list",
+				zap.Error(unmarshalErr),
+			)
+		}
+
+		ddbEntitys = append(ddbEntitys, ddbEntity)
+	}
+
+	return pageEntitys(ctx, query, ddbEntitys)
+}
+
+func (r *MemoryEntityRepository) getEntityItem(ctx context.Context, key KeyBasedStruct) (*types.DdbEntityItem, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := &types.DdbEntityItem{}
+	getItemErr := r.getItem(ctx, key, result)
+	if getItemErr != nil {
+		return &types.DdbEntityItem{}, getItemErr
+	}
+
+	return result, nil
+}
+
+// Evaluates the same condition the DynamoDB implementation sends with the
+// transaction before applying any of it
+func (r *MemoryEntityRepository) writeEntityChange(ctx context.Context, key KeyBasedStruct, current *types.DdbEntityItem, change entityChange) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := &types.DdbEntityItem{}
+	getItemErr := r.getItem(ctx, key, stored)
+	if getItemErr != nil {
+		return getItemErr
+	}
+
+	if r.itemExists(key) != (current.Id != "") || stored.Version != current.Version {
+		return conditionalCheckFailed()
+	}
+
+	historyItem := newDdbEntityHistoryItem(change, time.Now())
+	historyKey := KeyBasedStruct{
+		Id:          historyItem.Id,
+		SecondaryId: historyItem.SecondaryId,
+	}
+	if r.itemExists(historyKey) {
+		return conditionalCheckFailed()
+	}
+
+	if change.Remove {
+		r.deleteItem(key)
+	} else {
+		putItemErr := r.putItem(ctx, key, change.Item)
+		if putItemErr != nil {
+			return putItemErr
+		}
+	}
+
+	return r.putItem(ctx, historyKey, historyItem)
+}
+
+func (r *MemoryEntityRepository) deleteEntityChildren(ctx context.Context, entityId string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for sortKey := range r.items[entityId] {
+		r.deleteItem(KeyBasedStruct{
+			Id:          entityId,
+			SecondaryId: sortKey,
+		})
+	}
+
+	return nil
+}
+
+func (r *MemoryEntityRepository) expireEntityChildren(ctx context.Context, entityId string, ttl int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for sortKey, item := range r.items[entityId] {
+		if sortKey == config.EntitySortKey {
+			continue
+		}
+		if ttl == 0 {
+			delete(item, "ttl")
+		} else {
+			item["ttl"] = &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(ttl, 10)}
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryEntityRepository) CreateEntity(ctx context.Context, entity types.Entity) (*types.Entity, error) {
+	return createEntity(ctx, r, entity)
+}
+
+func (r *MemoryEntityRepository) ReadEntity(ctx context.Context, entityId string) (*types.Entity, error) {
+	return readEntity(ctx, r, entityId)
+}
+
+func (r *MemoryEntityRepository) UpdateEntity(ctx context.Context, entityId string, updated types.EntityUpdates, expectedVersion int, asOwner bool) (*types.Entity, error) {
+	return updateEntity(ctx, r, entityId, updated, expectedVersion)
+}
+
+func (r *MemoryEntityRepository) DeleteEntity(ctx context.Context, entityId string, expectedVersion int, asOwner bool) error {
+	return deleteEntity(ctx, r, entityId, expectedVersion)
+}
+
+func (r *MemoryEntityRepository) RestoreEntity(ctx context.Context, entityId string) (*types.Entity, error) {
+	return restoreEntity(ctx, r, entityId)
+}
+
+func (r *MemoryEntityRepository) QueryEntities(ctx context.Context, key string, limit int, nextToken string) ([]types.Entity, string, error) {
+	query := entityQuery(key, limit)
+
+	var startKey *types.DdbPrimaryKey
+	if nextToken != "" {
+		decodedKey, decodeErr := decodeNextToken(ctx, query, nextToken)
+		if decodeErr != nil {
+			return make([]types.Entity, 0), "", decodeErr
+		}
+		startKey = decodedKey
+	}
+
+	r.mutex.RLock()
+	items := r.queryItems(query, limit+1, startKey)
+	r.mutex.RUnlock()
+
+	return r.pageItems(ctx, query, items)
+}
+
+func (r *MemoryEntityRepository) ListEntities(ctx context.Context, limit int, nextToken string) ([]types.Entity, string, error) {
+	query := entityIndexQuery(limit)
+
+	var startKey *types.DdbPrimaryKey
+	if nextToken != "" {
+		decodedKey, decodeErr := decodeNextToken(ctx, query, nextToken)
+		if decodeErr != nil {
+			return make([]types.Entity, 0), "", decodeErr
+		}
+		startKey = decodedKey
+	}
+
+	r.mutex.RLock()
+	items := r.queryIndexItems(config.EntitySortKey, limit+1, startKey)
+	r.mutex.RUnlock()
+
+	return r.pageItems(ctx, query, items)
+}
+
+func (r *MemoryEntityRepository) QueryEntityHistory(ctx context.Context, entityId string, limit int, nextToken string) ([]types.EntityHistory, string, error) {
+	query := historyQuery(entityId, limit)
+
+	var startKey *types.DdbPrimaryKey
+	if nextToken != "" {
+		decodedKey, decodeErr := decodeNextToken(ctx, query, nextToken)
+		if decodeErr != nil {
+			return make([]types.EntityHistory, 0), "", decodeErr
+		}
+		startKey = decodedKey
+	}
+
+	r.mutex.RLock()
+	items := r.queryItems(query, limit+1, startKey)
+	r.mutex.RUnlock()
+
+	ddbHistory := make([]types.DdbEntityHistoryItem, 0, len(items))
+	for _, item := range items {
+		ddbHistoryItem := types.DdbEntityHistoryItem{}
+		unmarshalErr := attributevalue.UnmarshalMap(item, &ddbHistoryItem)
+		if unmarshalErr != nil {
+			common.LoggerFromContext(ctx).Error("Failed to unmarshal entity history from list",
+				zap.Error(unmarshalErr),
+			)
+		}
+
+		ddbHistory = append(ddbHistory, ddbHistoryItem)
+	}
+
+	return pageEntityHistory(ctx, query, ddbHistory)
+}
+
+// MemoryIdempotencyRepository keeps Idempotency-Keys in a map and applies
+// the same rules as the DynamoDB implementation.
+type MemoryIdempotencyRepository struct {
+	mutex sync.Mutex
+	items map[string]types.DdbIdempotencyItem
+}
+
+var _ IdempotencyRepository = (*MemoryIdempotencyRepository)(nil)
+
+func NewMemoryIdempotencyRepository() *MemoryIdempotencyRepository {
+	return &MemoryIdempotencyRepository{
+		items: make(map[string]types.DdbIdempotencyItem),
+	}
+}
+
+func (r *MemoryIdempotencyRepository) StartIdempotentRequest(ctx context.Context, principal string, key string, request interface{}) (*types.IdempotentResponse, error) {
+	requestHash, hashErr := hashIdempotentRequest(ctx, request)
+	if hashErr != nil {
+		return nil, hashErr
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	itemKey := idempotencyItemKey(principal, key)
+	now := time.Now()
+
+	existing := r.items[itemKey.Id]
+	if !isIdempotencyKeyClaimable(&existing, requestHash, now) {
+		return idempotencyKeyTakenResponse(&existing, requestHash)
+	}
+
+	r.items[itemKey.Id] = types.DdbIdempotencyItem{
+		Id:          itemKey.Id,
+		SecondaryId: itemKey.SecondaryId,
+		RequestHash: requestHash,
+		LockExpires: now.Add(config.IdempotencyLockTimeout).Unix(),
+		Ttl:         now.Add(config.IdempotencyKeyTtl).Unix(),
+	}
+
+	return nil, nil
+}
+
+func (r *MemoryIdempotencyRepository) CompleteIdempotentRequest(ctx context.Context, principal string, key string, response types.IdempotentResponse) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	itemKey := idempotencyItemKey(principal, key)
+	existing, exists := r.items[itemKey.Id]
+	if !exists {
+		return conditionalCheckFailed()
+	}
+
+	existing.Response = &response
+	existing.LockExpires = 0
+	r.items[itemKey.Id] = existing
+
+	return nil
+}
+
+func (r *MemoryIdempotencyRepository) ReleaseIdempotentRequest(ctx context.Context, principal string, key string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	itemKey := idempotencyItemKey(principal, key)
+	if r.items[itemKey.Id].Response != nil {
+		return conditionalCheckFailed()
+	}
+
+	delete(r.items, itemKey.Id)
+
+	return nil
+}
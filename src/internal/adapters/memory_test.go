@@ -0,0 +1,342 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	// Pagination tokens can't be signed without a key
+	config.PaginationTokenKey = "test-pagination-token-key"
+
+	os.Exit(m.Run())
+}
+
+// Whether err or anything it wraps has the same type as target
+func isErrorType(err error, target error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if reflect.TypeOf(err) == reflect.TypeOf(target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkError(t *testing.T, err error, wantErr error) {
+	t.Helper()
+
+	if wantErr == nil {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if !isErrorType(err, wantErr) {
+		t.Fatalf("got error %v (%T), want %T", err, err, wantErr)
+	}
+}
+
+func withSoftDelete(t *testing.T, retention time.Duration) {
+	previous := config.SoftDeleteRetention
+	config.SoftDeleteRetention = retention
+	t.Cleanup(func() {
+		config.SoftDeleteRetention = previous
+	})
+}
+
+func mustCreateEntity(t *testing.T, repo *MemoryEntityRepository, entityId string) {
+	t.Helper()
+
+	_, createErr := repo.CreateEntity(context.Background(), types.Entity{
+		Id:   entityId,
+		Name: "name-" + entityId,
+	})
+	if createErr != nil {
+		t.Fatalf("CreateEntity(%s): %v", entityId, createErr)
+	}
+}
+
+func TestMemoryEntityRepositoryCreate(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+		wantErr  error
+	}{
+		{name: "new entity"},
+		{name: "existing entity", existing: true, wantErr: &types.ConflictError{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMemoryEntityRepository()
+			if tt.existing {
+				mustCreateEntity(t, repo, "entity-1")
+			}
+
+			created, createErr := repo.CreateEntity(context.Background(), types.Entity{Id: "entity-1", Name: "created"})
+			checkError(t, createErr, tt.wantErr)
+			if tt.wantErr == nil && (created.Version != 1 || created.Name != "created") {
+				t.Errorf("got %+v, want version 1 named created", created)
+			}
+
+			entity, readErr := repo.ReadEntity(context.Background(), "entity-1")
+			checkError(t, readErr, nil)
+			if entity.Version != 1 {
+				t.Errorf("got version %d, want 1", entity.Version)
+			}
+		})
+	}
+}
+
+func TestMemoryEntityRepositoryUpdatePreconditions(t *testing.T) {
+	tests := []struct {
+		name            string
+		entityId        string
+		expectedVersion int
+		wantErr         error
+		wantVersion     int
+	}{
+		{name: "no If-Match", entityId: "entity-1", expectedVersion: types.UnconditionalVersion, wantVersion: 3},
+		{name: "If-Match *", entityId: "entity-1", expectedVersion: types.AnyVersion, wantVersion: 3},
+		{name: "current version", entityId: "entity-1", expectedVersion: 2, wantVersion: 3},
+		{name: "stale version", entityId: "entity-1", expectedVersion: 1, wantErr: &types.PreconditionFailedError{}},
+		{name: "legacy version", entityId: "entity-1", expectedVersion: 0, wantErr: &types.PreconditionFailedError{}},
+		{name: "future version", entityId: "entity-1", expectedVersion: 3, wantErr: &types.PreconditionFailedError{}},
+		{name: "missing entity", entityId: "missing", expectedVersion: types.UnconditionalVersion, wantErr: &types.MissingResourceError{}},
+		{name: "missing entity with If-Match", entityId: "missing", expectedVersion: types.AnyVersion, wantErr: &types.PreconditionFailedError{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMemoryEntityRepository()
+			mustCreateEntity(t, repo, "entity-1")
+			_, updateErr := repo.UpdateEntity(context.Background(), "entity-1", types.EntityUpdates{Name: "first"}, types.UnconditionalVersion, true)
+			checkError(t, updateErr, nil)
+
+			updated, updateErr := repo.UpdateEntity(context.Background(), tt.entityId, types.EntityUpdates{Name: "second"}, tt.expectedVersion, true)
+			checkError(t, updateErr, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+
+			if updated.Version != tt.wantVersion || updated.Name != "second" {
+				t.Errorf("got %+v, want version %d named second", updated, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestMemoryEntityRepositoryHistory(t *testing.T) {
+	repo := NewMemoryEntityRepository()
+	ctx := context.Background()
+	mustCreateEntity(t, repo, "entity-1")
+	_, updateErr := repo.UpdateEntity(ctx, "entity-1", types.EntityUpdates{Name: "updated"}, types.UnconditionalVersion, true)
+	checkError(t, updateErr, nil)
+
+	history, nextToken, queryErr := repo.QueryEntityHistory(ctx, "entity-1", 10, "")
+	checkError(t, queryErr, nil)
+	if nextToken != "" {
+		t.Errorf("got nextToken %q, want none", nextToken)
+	}
+
+	want := []struct {
+		operation string
+		version   int
+		name      string
+	}{
+		{types.EntityCreated, 1, "name-entity-1"},
+		{types.EntityUpdated, 2, "updated"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("got %d history items, want %d", len(history), len(want))
+	}
+	for i, w := range want {
+		got := history[i]
+		if got.Operation != w.operation || got.Version != w.version || got.Entity.Name != w.name {
+			t.Errorf("history[%d] = %+v, want %s version %d named %s", i, got, w.operation, w.version, w.name)
+		}
+	}
+
+	// A hard delete takes the history with it
+	checkError(t, repo.DeleteEntity(ctx, "entity-1", 2, true), nil)
+	history, _, queryErr = repo.QueryEntityHistory(ctx, "entity-1", 10, "")
+	checkError(t, queryErr, nil)
+	if len(history) != 0 {
+		t.Errorf("got %d history items after delete, want 0", len(history))
+	}
+	if partition, exists := repo.items["entity-1"]; exists {
+		t.Errorf("got %d items left in the partition after delete, want none", len(partition))
+	}
+}
+
+func TestMemoryEntityRepositoryPagination(t *testing.T) {
+	repo := NewMemoryEntityRepository()
+	ctx := context.Background()
+	for _, entityId := range []string{"entity-1", "entity-2", "entity-3"} {
+		mustCreateEntity(t, repo, entityId)
+	}
+
+	firstPage, nextToken, listErr := repo.ListEntities(ctx, 2, "")
+	checkError(t, listErr, nil)
+	if len(firstPage) != 2 || nextToken == "" {
+		t.Fatalf("got %d entities and nextToken %q, want 2 and a token", len(firstPage), nextToken)
+	}
+
+	secondPage, lastToken, listErr := repo.ListEntities(ctx, 2, nextToken)
+	checkError(t, listErr, nil)
+	if len(secondPage) != 1 || secondPage[0].Id != "entity-3" || lastToken != "" {
+		t.Fatalf("got %+v and nextToken %q, want only entity-3", secondPage, lastToken)
+	}
+
+	// A token only continues the query that issued it
+	tests := []struct {
+		name  string
+		query func(nextToken string) error
+	}{
+		{
+			name: "different limit",
+			query: func(nextToken string) error {
+				_, _, err := repo.ListEntities(ctx, 3, nextToken)
+				return err
+			},
+		},
+		{
+			name: "different query",
+			query: func(nextToken string) error {
+				_, _, err := repo.QueryEntityHistory(ctx, "entity-1", 2, nextToken)
+				return err
+			},
+		},
+		{
+			name: "tampered token",
+			query: func(nextToken string) error {
+				_, _, err := repo.ListEntities(ctx, 2, strings.ToUpper(nextToken))
+				return err
+			},
+		},
+		{
+			name: "not base64",
+			query: func(nextToken string) error {
+				_, _, err := repo.ListEntities(ctx, 2, "not a token!")
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, tt.query(nextToken), &types.InputError{})
+		})
+	}
+}
+
+func TestMemoryEntityRepositorySoftDelete(t *testing.T) {
+	withSoftDelete(t, time.Hour)
+	repo := NewMemoryEntityRepository()
+	ctx := context.Background()
+	mustCreateEntity(t, repo, "entity-1")
+	checkError(t, repo.DeleteEntity(ctx, "entity-1", types.UnconditionalVersion, true), nil)
+
+	entity, readErr := repo.ReadEntity(ctx, "entity-1")
+	checkError(t, readErr, nil)
+	if entity.Id != "" {
+		t.Errorf("read soft-deleted entity %+v, want none", entity)
+	}
+
+	entities, _, queryErr := repo.QueryEntities(ctx, "entity-1", 10, "")
+	checkError(t, queryErr, nil)
+	if len(entities) != 0 {
+		t.Errorf("got %d entities after soft delete, want 0", len(entities))
+	}
+
+	// Everything in the partition expires with the entity
+	for sortKey, item := range repo.items["entity-1"] {
+		if _, exists := item["ttl"]; !exists {
+			t.Errorf("item %s has no ttl after soft delete", sortKey)
+		}
+	}
+
+	restored, restoreErr := repo.RestoreEntity(ctx, "entity-1")
+	checkError(t, restoreErr, nil)
+	if restored.Id != "entity-1" || restored.Version != 3 {
+		t.Errorf("got %+v, want entity-1 at version 3", restored)
+	}
+
+	for sortKey, item := range repo.items["entity-1"] {
+		if _, exists := item["ttl"]; exists {
+			t.Errorf("item %s still has a ttl after restore", sortKey)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		entityId string
+		wantErr  error
+	}{
+		{name: "not deleted", entityId: "entity-1", wantErr: &types.ConflictError{}},
+		{name: "missing entity", entityId: "missing", wantErr: &types.MissingResourceError{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, restoreErr := repo.RestoreEntity(ctx, tt.entityId)
+			checkError(t, restoreErr, tt.wantErr)
+		})
+	}
+}
+
+func ttlOf(t *testing.T, repo *MemoryEntityRepository, entityId string, sortKey string) string {
+	t.Helper()
+
+	ttl, exists := repo.items[entityId][sortKey]["ttl"].(*ddbtypes.AttributeValueMemberN)
+	if !exists {
+		t.Fatalf("item %s has no ttl", sortKey)
+	}
+
+	return ttl.Value
+}
+
+func TestMemoryEntityRepositoryRepeatedSoftDelete(t *testing.T) {
+	withSoftDelete(t, time.Hour)
+	repo := NewMemoryEntityRepository()
+	ctx := context.Background()
+	mustCreateEntity(t, repo, "entity-1")
+	checkError(t, repo.DeleteEntity(ctx, "entity-1", types.UnconditionalVersion, true), nil)
+	entityTtl := ttlOf(t, repo, "entity-1", config.EntitySortKey)
+
+	// A fresh now+retention would land later than the entity's TTL
+	config.SoftDeleteRetention = 2 * time.Hour
+	tests := []struct {
+		name            string
+		expectedVersion int
+		wantErr         error
+	}{
+		{name: "without If-Match", expectedVersion: types.UnconditionalVersion, wantErr: nil},
+		{name: "with If-Match", expectedVersion: 2, wantErr: &types.PreconditionFailedError{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, repo.DeleteEntity(ctx, "entity-1", tt.expectedVersion, true), tt.wantErr)
+
+			if ttl := ttlOf(t, repo, "entity-1", config.EntitySortKey); ttl != entityTtl {
+				t.Errorf("entity ttl moved from %s to %s", entityTtl, ttl)
+			}
+			for sortKey := range repo.items["entity-1"] {
+				if ttl := ttlOf(t, repo, "entity-1", sortKey); ttl != entityTtl {
+					t.Errorf("item %s has ttl %s, want the entity's %s", sortKey, ttl, entityTtl)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package adapters
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+/*
+ * nextTokens are opaque to clients. Each one carries the last evaluated key,
+ * a hash of the query it was issued for and an expiry. Tokens are either
+ * signed with HMAC-SHA256 or, when PAGINATION_TOKEN_ENCRYPT is set, sealed
+ * with AES-GCM. Both keys are derived from PAGINATION_TOKEN_KEY.
+ *
+ * The same token format is used by every EntityRepository implementation so
+ * clients can not tell which one served them.
+ */
+
+const (
+	signedTokenVersion    byte = 1
+	encryptedTokenVersion byte = 2
+)
+
+// paginationQuery identifies the query a token was issued for. Any field
+// that changes which items a query returns (including future filters)
+// belongs here so a token can not be replayed against a different query.
+type paginationQuery struct {
+	IndexName     string `json:"i,omitempty"`
+	KeyName       string `json:"n"`
+	Key           string `json:"k"`
+	SortKeyPrefix string `json:"s,omitempty"`
+	// Only the item with exactly this sort key
+	SortKey string `json:"e,omitempty"`
+	Limit   int    `json:"l"`
+}
+
+// Every item in the partition, whatever its sort key
+func partitionQuery(key string, limit int) paginationQuery {
+	return paginationQuery{
+		KeyName: "id",
+		Key:     key,
+		Limit:   limit,
+	}
+}
+
+// Only the entity item of the partition, leaving out its history and
+// children
+func entityQuery(key string, limit int) paginationQuery {
+	return paginationQuery{
+		KeyName: "id",
+		Key:     key,
+		SortKey: config.EntitySortKey,
+		Limit:   limit,
+	}
+}
+
+func entityIndexQuery(limit int) paginationQuery {
+	return paginationQuery{
+		IndexName: config.EntityIndexName,
+		KeyName:   "secondaryId",
+		Key:       config.EntitySortKey,
+		Limit:     limit,
+	}
+}
+
+func historyQuery(entityId string, limit int) paginationQuery {
+	return paginationQuery{
+		KeyName:       "id",
+		Key:           entityId,
+		SortKeyPrefix: config.HistorySortKeyPrefix,
+		Limit:         limit,
+	}
+}
+
+func (q paginationQuery) hash() []byte {
+	// Marshalling a flat struct of strings and ints can not fail
+	queryBytes, _ := json.Marshal(q)
+	sum := sha256.Sum256(queryBytes)
+	return sum[:16]
+}
+
+type paginationTokenPayload struct {
+	LastEvalKey types.DdbPrimaryKey `json:"k"`
+	QueryHash   []byte              `json:"q"`
+	Expires     int64               `json:"e"`
+}
+
+var tokenMacKey []byte
+var tokenEncKey []byte
+var onceTokenKeys sync.Once
+
+// Every container has to use the same key, otherwise a nextToken only works
+// when the next page happens to be served by the container that issued it.
+// Handlers that page call this from GetLambdaHandler so a missing key fails
+// the deployment right away.
+func RequirePaginationTokenKey() {
+	if config.PaginationTokenKey == "" {
+		panic("PAGINATION_TOKEN_KEY is not set")
+	}
+}
+
+func getTokenKeys() ([]byte, []byte) {
+	RequirePaginationTokenKey()
+	onceTokenKeys.Do(func() {
+		secret := []byte(config.PaginationTokenKey)
+		tokenMacKey = deriveTokenKey(secret, "pagination-token-mac")
+		tokenEncKey = deriveTokenKey(secret, "pagination-token-enc")
+	})
+
+	return tokenMacKey, tokenEncKey
+}
+
+func deriveTokenKey(secret []byte, label string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+func invalidNextToken() error {
+	return &types.InputError{
+		Err: errors.New("Invalid nextToken."),
+	}
+}
+
+func encodeNextToken(ctx context.Context, query paginationQuery, lastEvalKey *types.DdbPrimaryKey) (string, error) {
+	payload, jsonErr := json.Marshal(&paginationTokenPayload{
+		LastEvalKey: *lastEvalKey,
+		QueryHash:   query.hash(),
+		Expires:     time.Now().Add(config.PaginationTokenTtl).Unix(),
+	})
+	if jsonErr != nil {
+		common.LoggerFromContext(ctx).Error("Failed to marshal last evaluated key json",
+			zap.Error(jsonErr),
+		)
+		return "", jsonErr
+	}
+
+	macKey, encKey := getTokenKeys()
+
+	var token []byte
+	if config.PaginationTokenEncrypt {
+		gcm, gcmErr := newTokenCipher(encKey)
+		if gcmErr != nil {
+			common.LoggerFromContext(ctx).Error("Failed to create token cipher",
+				zap.Error(gcmErr),
+			)
+			return "", gcmErr
+		}
+
+		nonce := make([]byte, gcm.NonceSize())
+		if _, randErr := io.ReadFull(rand.Reader, nonce); randErr != nil {
+			return "", randErr
+		}
+
+		header := []byte{encryptedTokenVersion}
+		token = append(header, nonce...)
+		token = gcm.Seal(token, nonce, payload, header)
+	} else {
+		token = append([]byte{signedTokenVersion}, payload...)
+		mac := hmac.New(sha256.New, macKey)
+		mac.Write(token)
+		token = mac.Sum(token)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+func decodeNextToken(ctx context.Context, query paginationQuery, nextToken string) (*types.DdbPrimaryKey, error) {
+	token, decErr := base64.RawURLEncoding.DecodeString(nextToken)
+	if decErr != nil || len(token) == 0 {
+		common.LoggerFromContext(ctx).Error("Failed to decode nextToken base64",
+			zap.Error(decErr),
+		)
+		return &types.DdbPrimaryKey{}, invalidNextToken()
+	}
+
+	payload, openErr := openNextToken(token)
+	if openErr != nil {
+		common.LoggerFromContext(ctx).Error("Failed to authenticate nextToken",
+			zap.Error(openErr),
+		)
+		return &types.DdbPrimaryKey{}, invalidNextToken()
+	}
+
+	tokenPayload := &paginationTokenPayload{}
+	jsonErr := json.Unmarshal(payload, tokenPayload)
+	if jsonErr != nil {
+		common.LoggerFromContext(ctx).Error("Failed to unmarshal nextToken json",
+			zap.Error(jsonErr),
+		)
+		return &types.DdbPrimaryKey{}, invalidNextToken()
+	}
+
+	if !hmac.Equal(tokenPayload.QueryHash, query.hash()) {
+		common.LoggerFromContext(ctx).Error("nextToken was issued for a different query")
+		return &types.DdbPrimaryKey{}, invalidNextToken()
+	}
+
+	if time.Now().Unix() > tokenPayload.Expires {
+		return &types.DdbPrimaryKey{}, &types.InputError{
+			Err: errors.New("nextToken has expired."),
+		}
+	}
+
+	return &tokenPayload.LastEvalKey, nil
+}
+
+// Verifies or decrypts a raw token and returns its JSON payload
+func openNextToken(token []byte) ([]byte, error) {
+	macKey, encKey := getTokenKeys()
+
+	switch token[0] {
+	case signedTokenVersion:
+		if len(token) < 1+sha256.Size {
+			return nil, errors.New("signed token is too short")
+		}
+
+		signed, signature := token[:len(token)-sha256.Size], token[len(token)-sha256.Size:]
+		mac := hmac.New(sha256.New, macKey)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, errors.New("signature mismatch")
+		}
+
+		return signed[1:], nil
+	case encryptedTokenVersion:
+		gcm, gcmErr := newTokenCipher(encKey)
+		if gcmErr != nil {
+			return nil, gcmErr
+		}
+
+		if len(token) < 1+gcm.NonceSize() {
+			return nil, errors.New("encrypted token is too short")
+		}
+
+		header := token[:1]
+		nonce := token[1 : 1+gcm.NonceSize()]
+		return gcm.Open(nil, nonce, token[1+gcm.NonceSize():], header)
+	default:
+		return nil, errors.New("unknown token version")
+	}
+}
+
+func newTokenCipher(key []byte) (cipher.AEAD, error) {
+	block, blockErr := aes.NewCipher(key)
+	if blockErr != nil {
+		return nil, blockErr
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Expects up to limit+1 items. Only the first limit are returned and the key
+// of the last returned item becomes the nextToken when there were more.
+func pageResults[T any, R any](ctx context.Context, query paginationQuery, items []T, keyOf func(*T) types.DdbPrimaryKey, normalize func(*T) R) ([]R, string, error) {
+	limit := query.Limit
+	results := make([]R, 0, len(items))
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+
+	for i := range items {
+		results = append(results, normalize(&items[i]))
+	}
+
+	if !hasMore || len(items) == 0 {
+		return results, "", nil
+	}
+
+	lastEvalKey := keyOf(&items[len(items)-1])
+	nextToken, encodeErr := encodeNextToken(ctx, query, &lastEvalKey)
+	if encodeErr != nil {
+		return results, "", encodeErr
+	}
+
+	return results, nextToken, nil
+}
+
+func pageEntitys(ctx context.Context, query paginationQuery, ddbEntitys []types.DdbEntityItem) ([]types.Entity, string, error) {
+	return pageResults(ctx, query, ddbEntitys, func(ddb *types.DdbEntityItem) types.DdbPrimaryKey {
+		return types.DdbPrimaryKey{
+			Id:          ddb.Id,
+			SecondaryId: ddb.SecondaryId,
+		}
+	}, normalizeDdbEntity)
+}
+
+func pageEntityHistory(ctx context.Context, query paginationQuery, ddbHistory []types.DdbEntityHistoryItem) ([]types.EntityHistory, string, error) {
+	return pageResults(ctx, query, ddbHistory, func(ddb *types.DdbEntityHistoryItem) types.DdbPrimaryKey {
+		return types.DdbPrimaryKey{
+			Id:          ddb.Id,
+			SecondaryId: ddb.SecondaryId,
+		}
+	}, normalizeDdbEntityHistory)
+}
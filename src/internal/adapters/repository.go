@@ -0,0 +1,44 @@
+package adapters
+
+import (
+	"context"
+	"sync"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// EntityRepository covers every entity operation the handlers need. The
+// DynamoDB implementation is used when deployed and the in-memory
+// implementation can be injected into logic functions for tests.
+type EntityRepository interface {
+	// Returns the entity as it was stored, at its first version
+	CreateEntity(ctx context.Context, entity types.Entity) (*types.Entity, error)
+	ReadEntity(ctx context.Context, entityId string) (*types.Entity, error)
+	// expectedVersion is types.UnconditionalVersion, types.AnyVersion or the
+	// version the caller last saw
+	UpdateEntity(ctx context.Context, entityId string, updated types.EntityUpdates, expectedVersion int, asOwner bool) (*types.Entity, error)
+	DeleteEntity(ctx context.Context, entityId string, expectedVersion int, asOwner bool) error
+	RestoreEntity(ctx context.Context, entityId string) (*types.Entity, error)
+	QueryEntities(ctx context.Context, key string, limit int, nextToken string) ([]types.Entity, string, error)
+	ListEntities(ctx context.Context, limit int, nextToken string) ([]types.Entity, string, error)
+	QueryEntityHistory(ctx context.Context, entityId string, limit int, nextToken string) ([]types.EntityHistory, string, error)
+}
+
+var entityRepository EntityRepository
+var onceEntityRepository sync.Once
+
+func GetEntityRepository() EntityRepository {
+	onceEntityRepository.Do(func() {
+		entityRepository = NewDynamodbEntityRepository()
+	})
+
+	return entityRepository
+}
+
+// Replaces the repository GetEntityRepository hands out. Only takes effect
+// before the first call to GetEntityRepository.
+func SetEntityRepository(repo EntityRepository) {
+	onceEntityRepository.Do(func() {
+		entityRepository = repo
+	})
+}
@@ -7,24 +7,63 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common/metrics"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/tracing"
 )
 
-func snsPublish(messageStruct interface{}, messageAttributes map[string]types.MessageAttributeValue) (*sns.PublishOutput, error) {
+func snsPublish(ctx context.Context, messageStruct interface{}, messageAttributes map[string]types.MessageAttributeValue) (*sns.PublishOutput, error) {
 	snsClient := GetSnsClient()
 
+	ctx, span := tracing.Tracer().Start(ctx, "SNS.Publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.RPCSystemKey.String("aws-api"),
+			semconv.RPCService("SNS"),
+			semconv.RPCMethod("Publish"),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(config.PrimaryTopicArn),
+		),
+	)
+	defer span.End()
+
+	// Subscribers continue the trace from these, see cmd/eventAction
+	carrier := propagation.MapCarrier{}
+	tracing.Propagator().Inject(ctx, carrier)
+	attributes := make(map[string]types.MessageAttributeValue, len(messageAttributes)+len(carrier))
+	for name, value := range messageAttributes {
+		attributes[name] = value
+	}
+	for name, value := range carrier {
+		attributes[name] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+
 	messageBytes, marshalErr := json.Marshal(messageStruct)
 	if marshalErr != nil {
+		metrics.Increment("SnsPublishFailures", nil)
+		tracing.RecordError(span, marshalErr)
 		return &sns.PublishOutput{}, marshalErr
 	}
 	message := string(messageBytes)
 
-	publishRes, publishErr := snsClient.Publish(context.TODO(), &sns.PublishInput{
+	callCtx, cancel := callContext(ctx)
+	defer cancel()
+
+	publishRes, publishErr := snsClient.Publish(callCtx, &sns.PublishInput{
 		TopicArn:          aws.String(config.PrimaryTopicArn),
-		MessageAttributes: messageAttributes,
+		MessageAttributes: attributes,
 		Message:           &message,
 	})
 	if publishErr != nil {
-		return &sns.PublishOutput{}, publishErr
+		metrics.Increment("SnsPublishFailures", nil)
+		tracing.RecordError(span, publishErr)
+		return &sns.PublishOutput{}, translateTimeout(ctx, publishErr)
 	}
 
 	return publishRes, nil
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"math/big"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -36,3 +37,12 @@ func GetEnv(key string, def string) string {
 
 	return value
 }
+
+func GetEnvInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+
+	return value
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/thomasstep/giphy-livechat-api/internal/common"
 )
@@ -10,17 +12,56 @@ type ConfigStruct struct {
 	Region string
 
 	// Authorization service
-	// JwksUrl string
-	// JwkId   string
+	JwksUrl string
+	// Checked when set
+	JwtIssuer   string
+	JwtAudience string
+	// Tokens signed with any other algorithm are denied
+	JwtAlgorithms []string
+	// Leeway for exp, nbf and iat
+	JwtClockSkew time.Duration
+	// Least time between two JWKS fetches caused by unknown key IDs
+	JwksMinRefreshInterval time.Duration
 	// AuthUrl string
 
 	// Database related
 	PrimaryTableName string
+	// Only set when running against a local DynamoDB-compatible server
+	DynamodbEndpoint string
 	Limit            int
-	EntitySortKey  string
+	EntitySortKey    string
+	// History items are stored as <prefix><timestamp>#<version>
+	HistorySortKeyPrefix string
+	// Index keyed by secondaryId and sorted by id, used to list every entity
+	EntityIndexName string
+
+	// Soft-deleted entities are purged by the table's TTL after this long.
+	// Deletes are permanent when it is zero.
+	SoftDeleteRetention time.Duration
+
+	// Idempotency-Key items are stored under <prefix><key>
+	IdempotencyKeyPrefix string
+	IdempotencySortKey   string
+	IdempotencyKeyTtl    time.Duration
+	// How long a request holds its key before a retry may take over
+	IdempotencyLockTimeout time.Duration
+
+	// Pagination tokens
+	PaginationTokenKey     string
+	PaginationTokenEncrypt bool
+	PaginationTokenTtl     time.Duration
+
+	// Sent with entities so clients and CDNs revalidate them
+	ReadCacheControl string
 
 	// SNS related
-	PrimaryTopicArn          string
+	PrimaryTopicArn string
+
+	// Upper bound for a single AWS call, including the SDK's retries
+	AwsCallTimeout time.Duration
+	// Kept back from the Lambda deadline so a timed out call can still be
+	// answered with a 504
+	DeadlineReserve time.Duration
 }
 
 var Config *ConfigStruct
@@ -29,14 +70,32 @@ var onceConfig sync.Once
 func GetConfig() *ConfigStruct {
 	onceConfig.Do(func() {
 		Config = &ConfigStruct{
-			Region:                   common.GetEnv("AWS_REGION", "us-east-1"),
-			// JwksUrl:                  common.GetEnv("JWKS_URL", ""),
-			// JwkId:                    common.GetEnv("JWK_ID", ""),
+			Region:                 common.GetEnv("AWS_REGION", "us-east-1"),
+			JwksUrl:                common.GetEnv("JWKS_URL", ""),
+			JwtIssuer:              common.GetEnv("JWT_ISSUER", ""),
+			JwtAudience:            common.GetEnv("JWT_AUDIENCE", ""),
+			JwtAlgorithms:          strings.Split(common.GetEnv("JWT_ALGORITHMS", "RS256"), ","),
+			JwtClockSkew:           time.Duration(common.GetEnvInt("JWT_CLOCK_SKEW_SECONDS", 60)) * time.Second,
+			JwksMinRefreshInterval: time.Duration(common.GetEnvInt("JWKS_MIN_REFRESH_SECONDS", 60)) * time.Second,
 			// AuthUrl:                  common.GetEnv("AUTH_URL", ""),
-			PrimaryTableName:         common.GetEnv("PRIMARY_TABLE_NAME", ""),
-			Limit:                    20, // BatchWrite on DDB has limit of 25
+			PrimaryTableName:       common.GetEnv("PRIMARY_TABLE_NAME", ""),
+			DynamodbEndpoint:       common.GetEnv("DYNAMODB_ENDPOINT", ""),
+			Limit:                  20, // BatchWrite on DDB has limit of 25
 			EntitySortKey:          "entity",
-			PrimaryTopicArn:          common.GetEnv("PRIMARY_SNS_TOPIC_ARN", ""),
+			HistorySortKeyPrefix:   "history#",
+			EntityIndexName:        "secondaryId-id-index",
+			SoftDeleteRetention:    time.Duration(common.GetEnvInt("SOFT_DELETE_RETENTION_DAYS", 0)) * 24 * time.Hour,
+			IdempotencyKeyPrefix:   "idempotency#",
+			IdempotencySortKey:     "idempotency",
+			IdempotencyKeyTtl:      24 * time.Hour,
+			IdempotencyLockTimeout: time.Minute,
+			PaginationTokenKey:     common.GetEnv("PAGINATION_TOKEN_KEY", ""),
+			PaginationTokenEncrypt: common.GetEnv("PAGINATION_TOKEN_ENCRYPT", "false") == "true",
+			PaginationTokenTtl:     time.Hour,
+			ReadCacheControl:       common.GetEnv("READ_CACHE_CONTROL", "private, no-cache"),
+			PrimaryTopicArn:        common.GetEnv("PRIMARY_SNS_TOPIC_ARN", ""),
+			AwsCallTimeout:         time.Duration(common.GetEnvInt("AWS_CALL_TIMEOUT_MS", 2000)) * time.Millisecond,
+			DeadlineReserve:        time.Duration(common.GetEnvInt("DEADLINE_RESERVE_MS", 250)) * time.Millisecond,
 		}
 	})
 	return Config
@@ -0,0 +1,222 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// CorsPolicy decides which cross-origin requests browsers may make.
+// AllowedOrigins holds exact origins like https://app.example.com, wildcard
+// subdomains like https://*.example.com or * for any origin.
+type CorsPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// How long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// Built from CORS_ALLOWED_ORIGINS, a comma separated allowlist. The older
+// CORS_ALLOW_ORIGIN_HEADER is used when it is not set. Credentials are only
+// allowed when CORS_ALLOW_CREDENTIALS is true. They used to be allowed by
+// default, so deployments that rely on cookies have to opt in through the
+// corsAllowCredentials infra config.
+func DefaultCorsPolicy() CorsPolicy {
+	// These values can not come from config due to a circular dependency
+	origins := GetEnv("CORS_ALLOWED_ORIGINS", GetEnv("CORS_ALLOW_ORIGIN_HEADER", ""))
+
+	return CorsPolicy{
+		AllowedOrigins: splitList(origins),
+		AllowedMethods: []string{
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodDelete,
+		},
+		AllowedHeaders: []string{
+			"Authorization",
+			"Content-Type",
+			"Idempotency-Key",
+			"If-Match",
+			"If-None-Match",
+			"X-Api-Key",
+		},
+		AllowCredentials: GetEnv("CORS_ALLOW_CREDENTIALS", "false") == "true",
+		MaxAge:           time.Duration(GetEnvInt("CORS_MAX_AGE_SECONDS", 600)) * time.Second,
+	}
+}
+
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Returns the Access-Control-Allow-Origin value for origin, or false when
+// the origin is not allowed. Origins that are only allowed through * get a
+// literal * and never credentials, anything else would let every site make
+// credentialed requests.
+func (p CorsPolicy) allowOrigin(origin string) (string, bool) {
+	anyOrigin := false
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			anyOrigin = true
+			continue
+		}
+		if matchOrigin(allowed, origin) {
+			return origin, true
+		}
+	}
+
+	if anyOrigin {
+		return "*", true
+	}
+	return "", false
+}
+
+// Browsers reject credentials together with *
+func (p CorsPolicy) allowCredentials(allowOrigin string) bool {
+	return p.AllowCredentials && allowOrigin != "*"
+}
+
+func matchOrigin(allowed string, origin string) bool {
+	allowed = strings.ToLower(allowed)
+	origin = strings.ToLower(origin)
+
+	prefix, suffix, wildcard := strings.Cut(allowed, "*")
+	if !wildcard {
+		return allowed == origin
+	}
+
+	// https://*.example.com matches a.example.com and a.b.example.com but
+	// not example.com itself
+	if len(origin) <= len(prefix)+len(suffix) {
+		return false
+	}
+	return strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func addVary(headers map[string]string, names ...string) {
+	vary := splitList(headers["Vary"])
+	for _, name := range names {
+		if !containsFold(vary, name) {
+			vary = append(vary, name)
+		}
+	}
+	headers["Vary"] = strings.Join(vary, ", ")
+}
+
+// Answers OPTIONS requests itself and adds CORS headers to every other
+// response, including error responses when it runs outside ErrorMiddleware
+func NewCorsMiddleware(policy CorsPolicy) Middleware {
+	return func(next types.HandlerSignature) types.HandlerSignature {
+		return func(ctx context.Context, request types.Request) (types.Response, error) {
+			origin := GetHeader(request.Headers, "Origin")
+			// No route serves OPTIONS and it skips the authorizer, so it
+			// never reaches next
+			if request.Method == http.MethodOptions {
+				return policy.preflight(
+					origin,
+					GetHeader(request.Headers, "Access-Control-Request-Method"),
+					GetHeader(request.Headers, "Access-Control-Request-Headers"),
+				), nil
+			}
+
+			res, err := next(ctx, request)
+			if err != nil {
+				return res, err
+			}
+
+			if res.Headers == nil {
+				res.Headers = map[string]string{}
+			}
+			addVary(res.Headers, "Origin")
+
+			allowOrigin, allowed := policy.allowOrigin(origin)
+			if origin == "" || !allowed {
+				return res, nil
+			}
+
+			res.Headers["Access-Control-Allow-Origin"] = allowOrigin
+			if policy.allowCredentials(allowOrigin) {
+				res.Headers["Access-Control-Allow-Credentials"] = "true"
+			}
+			if len(policy.ExposedHeaders) > 0 {
+				res.Headers["Access-Control-Expose-Headers"] = strings.Join(policy.ExposedHeaders, ", ")
+			}
+
+			return res, nil
+		}
+	}
+}
+
+// A preflight that is not allowed still gets a 204, browsers block the
+// actual request because the CORS headers are missing
+func (p CorsPolicy) preflight(origin string, requestedMethod string, requestedHeaders string) types.Response {
+	res := types.Response{
+		StatusCode: http.StatusNoContent,
+		Headers:    map[string]string{},
+	}
+	addVary(res.Headers, "Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers")
+
+	allowOrigin, allowed := p.allowOrigin(origin)
+	if !allowed || !containsFold(p.AllowedMethods, requestedMethod) {
+		return res
+	}
+	for _, header := range splitList(requestedHeaders) {
+		if !containsFold(p.AllowedHeaders, header) {
+			return res
+		}
+	}
+
+	res.Headers["Access-Control-Allow-Origin"] = allowOrigin
+	res.Headers["Access-Control-Allow-Methods"] = strings.Join(p.AllowedMethods, ", ")
+	if len(p.AllowedHeaders) > 0 {
+		res.Headers["Access-Control-Allow-Headers"] = strings.Join(p.AllowedHeaders, ", ")
+	}
+	if p.allowCredentials(allowOrigin) {
+		res.Headers["Access-Control-Allow-Credentials"] = "true"
+	}
+	if p.MaxAge > 0 {
+		res.Headers["Access-Control-Max-Age"] = strconv.Itoa(int(p.MaxAge.Seconds()))
+	}
+
+	return res
+}
+
+// Uses DefaultCorsPolicy. Routes that need another policy use
+// NewCorsMiddleware instead.
+func CorsMiddleware(next types.HandlerSignature) types.HandlerSignature {
+	return NewCorsMiddleware(DefaultCorsPolicy())(next)
+}
+
+// Preflight requests carry the method of the request they ask about, which
+// is what routers should match on
+func IsPreflight(request types.Request) bool {
+	return request.Method == http.MethodOptions &&
+		GetHeader(request.Headers, "Origin") != "" &&
+		GetHeader(request.Headers, "Access-Control-Request-Method") != ""
+}
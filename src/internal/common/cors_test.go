@@ -0,0 +1,125 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func testCorsPolicy(origins ...string) CorsPolicy {
+	return CorsPolicy{
+		AllowedOrigins:   origins,
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+}
+
+func TestCorsMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		origins         []string
+		origin          string
+		wantOrigin      string
+		wantCredentials bool
+	}{
+		{name: "exact origin", origins: []string{"https://app.example.com"}, origin: "https://app.example.com", wantOrigin: "https://app.example.com", wantCredentials: true},
+		{name: "origins are case-insensitive", origins: []string{"https://App.Example.com"}, origin: "https://app.example.com", wantOrigin: "https://app.example.com", wantCredentials: true},
+		{name: "wildcard subdomain", origins: []string{"https://*.example.com"}, origin: "https://a.b.example.com", wantOrigin: "https://a.b.example.com", wantCredentials: true},
+		{name: "wildcard does not match the bare domain", origins: []string{"https://*.example.com"}, origin: "https://example.com"},
+		{name: "wildcard does not match a lookalike", origins: []string{"https://*.example.com"}, origin: "https://evilexample.com"},
+		{name: "origin not listed", origins: []string{"https://app.example.com"}, origin: "https://evil.example.org"},
+		{name: "any origin never gets credentials", origins: []string{"*"}, origin: "https://evil.example.org", wantOrigin: "*"},
+		{name: "listed origin wins over any origin", origins: []string{"*", "https://app.example.com"}, origin: "https://app.example.com", wantOrigin: "https://app.example.com", wantCredentials: true},
+		{name: "no origin", origins: []string{"*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewCorsMiddleware(testCorsPolicy(tt.origins...))(handlerReturning(types.Response{StatusCode: http.StatusOK}, nil))
+			res, err := handler(context.Background(), types.Request{
+				Method:  http.MethodGet,
+				Headers: map[string]string{"Origin": tt.origin},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := res.Headers["Access-Control-Allow-Origin"]; got != tt.wantOrigin {
+				t.Errorf("got Access-Control-Allow-Origin %q, want %q", got, tt.wantOrigin)
+			}
+			if got := res.Headers["Access-Control-Allow-Credentials"] == "true"; got != tt.wantCredentials {
+				t.Errorf("got credentials %t, want %t", got, tt.wantCredentials)
+			}
+			if got := res.Headers["Vary"]; got != "Origin" {
+				t.Errorf("got Vary %q, want Origin", got)
+			}
+		})
+	}
+}
+
+func TestCorsMiddlewarePreflight(t *testing.T) {
+	tests := []struct {
+		name             string
+		origins          []string
+		requestedMethod  string
+		requestedHeaders string
+		wantOrigin       string
+		wantCredentials  bool
+	}{
+		{name: "allowed", origins: []string{"https://app.example.com"}, requestedMethod: http.MethodPut, requestedHeaders: "authorization, content-type", wantOrigin: "https://app.example.com", wantCredentials: true},
+		{name: "any origin", origins: []string{"*"}, requestedMethod: http.MethodGet, wantOrigin: "*"},
+		{name: "origin not listed", origins: []string{"https://other.example.com"}, requestedMethod: http.MethodGet},
+		{name: "method not allowed", origins: []string{"https://app.example.com"}, requestedMethod: http.MethodDelete},
+		{name: "header not allowed", origins: []string{"https://app.example.com"}, requestedMethod: http.MethodGet, requestedHeaders: "X-Custom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := func(ctx context.Context, request types.Request) (types.Response, error) {
+				called = true
+				return types.Response{}, nil
+			}
+
+			res, err := NewCorsMiddleware(testCorsPolicy(tt.origins...))(next)(context.Background(), types.Request{
+				Method: http.MethodOptions,
+				Headers: map[string]string{
+					"Origin":                         "https://app.example.com",
+					"Access-Control-Request-Method":  tt.requestedMethod,
+					"Access-Control-Request-Headers": tt.requestedHeaders,
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if called {
+				t.Error("preflight reached the handler")
+			}
+
+			if res.StatusCode != http.StatusNoContent {
+				t.Errorf("got status %d, want 204", res.StatusCode)
+			}
+			if got := res.Headers["Access-Control-Allow-Origin"]; got != tt.wantOrigin {
+				t.Errorf("got Access-Control-Allow-Origin %q, want %q", got, tt.wantOrigin)
+			}
+			if got := res.Headers["Access-Control-Allow-Credentials"] == "true"; got != tt.wantCredentials {
+				t.Errorf("got credentials %t, want %t", got, tt.wantCredentials)
+			}
+			if tt.wantOrigin == "" {
+				return
+			}
+			if got := res.Headers["Access-Control-Allow-Methods"]; got != "GET, PUT" {
+				t.Errorf("got Access-Control-Allow-Methods %q", got)
+			}
+			if got := res.Headers["Access-Control-Max-Age"]; got != "600" {
+				t.Errorf("got Access-Control-Max-Age %q, want 600", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+/*
+ * Handlers work on types.Request and types.Response so one build can sit
+ * behind a REST API (payload v1), an HTTP API (payload v2), a Lambda
+ * Function URL or an Application Load Balancer. The functions below convert
+ * between those and the event types of each front end.
+ */
+
+// Only the fields needed to tell the event formats apart
+type eventProbe struct {
+	Version        string `json:"version"`
+	HTTPMethod     string `json:"httpMethod"`
+	RequestContext struct {
+		DomainName string           `json:"domainName"`
+		Elb        *json.RawMessage `json:"elb"`
+	} `json:"requestContext"`
+}
+
+// resource is the route template the handler is deployed for. ALBs and
+// Function URLs do not route on templates, so path parameters are taken from
+// the path with it and requests that do not fit it get a 404. Handlers that
+// route on their own, like the one from NewRouter, pass an empty resource.
+func LambdaEventAdapter(resource string, handler types.HandlerSignature) types.LambdaEventHandlerSignature {
+	notFoundHandler := DefaultChain().Then(func(ctx context.Context, request types.Request) (types.Response, error) {
+		return types.Response{}, &types.MissingResourceError{
+			Err: errors.New("Not Found"),
+		}
+	})
+
+	// Fills in the path parameters and resource for front ends that do not
+	routeHandler := func(ctx context.Context, request types.Request) (types.Response, error) {
+		if resource == "" {
+			return handler(ctx, request)
+		}
+
+		pathParameters, matched := MatchResource(resource, request.Path)
+		if !matched {
+			return notFoundHandler(ctx, request)
+		}
+
+		request.Resource = resource
+		request.PathParameters = pathParameters
+		return handler(ctx, request)
+	}
+
+	return func(ctx context.Context, event json.RawMessage) (interface{}, error) {
+		probe := eventProbe{}
+		probeErr := json.Unmarshal(event, &probe)
+		if probeErr != nil {
+			return nil, probeErr
+		}
+
+		switch {
+		case probe.RequestContext.Elb != nil:
+			albRequest := events.ALBTargetGroupRequest{}
+			unmarshalErr := json.Unmarshal(event, &albRequest)
+			if unmarshalErr != nil {
+				return nil, unmarshalErr
+			}
+
+			res, err := routeHandler(ctx, NewRequestFromAlb(albRequest))
+			if err != nil {
+				return nil, err
+			}
+
+			// ALBs expect the same header format they sent
+			return NewAlbResponse(res, albRequest.MultiValueHeaders != nil), nil
+		case probe.Version == "2.0" && strings.Contains(probe.RequestContext.DomainName, ".lambda-url."):
+			urlRequest := events.LambdaFunctionURLRequest{}
+			unmarshalErr := json.Unmarshal(event, &urlRequest)
+			if unmarshalErr != nil {
+				return nil, unmarshalErr
+			}
+
+			res, err := routeHandler(ctx, NewRequestFromFunctionUrl(urlRequest))
+			if err != nil {
+				return nil, err
+			}
+
+			return NewFunctionUrlResponse(res), nil
+		case probe.Version == "2.0":
+			v2Request := events.APIGatewayV2HTTPRequest{}
+			unmarshalErr := json.Unmarshal(event, &v2Request)
+			if unmarshalErr != nil {
+				return nil, unmarshalErr
+			}
+
+			res, err := handler(ctx, NewRequestFromV2(v2Request))
+			if err != nil {
+				return nil, err
+			}
+
+			return NewV2Response(res), nil
+		case probe.HTTPMethod != "":
+			proxyRequest := events.APIGatewayProxyRequest{}
+			unmarshalErr := json.Unmarshal(event, &proxyRequest)
+			if unmarshalErr != nil {
+				return nil, unmarshalErr
+			}
+
+			res, err := handler(ctx, NewRequestFromProxy(proxyRequest))
+			if err != nil {
+				return nil, err
+			}
+
+			return NewProxyResponse(res), nil
+		default:
+			return nil, errors.New("Error: Unsupported event")
+		}
+	}
+}
+
+// Returns the path parameters when path fits the resource template, e.g.
+// /v1/entity/{entityId}. path is expected to be escaped, parameters come back
+// unescaped like API Gateway passes them.
+func MatchResource(resource string, path string) (map[string]string, bool) {
+	resourcePieces := strings.Split(strings.Trim(resource, "/"), "/")
+	pathPieces := strings.Split(strings.Trim(path, "/"), "/")
+	if len(resourcePieces) != len(pathPieces) {
+		return nil, false
+	}
+
+	pathParameters := map[string]string{}
+	for i, resourcePiece := range resourcePieces {
+		if strings.HasPrefix(resourcePiece, "{") && strings.HasSuffix(resourcePiece, "}") {
+			value, unescapeErr := url.PathUnescape(pathPieces[i])
+			if unescapeErr != nil || value == "" {
+				return nil, false
+			}
+			pathParameters[strings.Trim(resourcePiece, "{}")] = value
+			continue
+		}
+
+		if resourcePiece != pathPieces[i] {
+			return nil, false
+		}
+	}
+
+	return pathParameters, true
+}
+
+func decodeBody(body string, isBase64Encoded bool) string {
+	if !isBase64Encoded {
+		return body
+	}
+
+	decoded, decodeErr := base64.StdEncoding.DecodeString(body)
+	if decodeErr != nil {
+		// Leave it to the handler to reject
+		return body
+	}
+
+	return string(decoded)
+}
+
+// Splits a Cookie header into the name=value pairs HTTP APIs pass as cookies
+func splitCookieHeader(header string) []string {
+	cookies := []string{}
+	for _, cookie := range strings.Split(header, ";") {
+		cookie = strings.TrimSpace(cookie)
+		if cookie != "" {
+			cookies = append(cookies, cookie)
+		}
+	}
+
+	return cookies
+}
+
+func NewRequestFromProxy(event events.APIGatewayProxyRequest) types.Request {
+	return types.Request{
+		Method:                event.HTTPMethod,
+		Path:                  event.Path,
+		Resource:              event.Resource,
+		Headers:               event.Headers,
+		MultiValueHeaders:     event.MultiValueHeaders,
+		QueryStringParameters: event.QueryStringParameters,
+		PathParameters:        event.PathParameters,
+		Cookies:               splitCookieHeader(GetHeader(event.Headers, "Cookie")),
+		Body:                  decodeBody(event.Body, event.IsBase64Encoded),
+		RequestId:             event.RequestContext.RequestID,
+		Authorizer:            event.RequestContext.Authorizer,
+	}
+}
+
+// rawPath of HTTP APIs starts with the stage unless it is $default, routes
+// never do
+func stripStage(rawPath string, stage string) string {
+	if stage == "" || stage == "$default" {
+		return rawPath
+	}
+
+	prefix := "/" + stage
+	if rawPath == prefix {
+		return "/"
+	}
+	if strings.HasPrefix(rawPath, prefix+"/") {
+		return strings.TrimPrefix(rawPath, prefix)
+	}
+
+	return rawPath
+}
+
+func NewRequestFromV2(event events.APIGatewayV2HTTPRequest) types.Request {
+	// Route keys look like "GET /v1/entity/{entityId}" or "$default"
+	resource := ""
+	routeKeyPieces := strings.SplitN(event.RouteKey, " ", 2)
+	if len(routeKeyPieces) == 2 {
+		resource = routeKeyPieces[1]
+	}
+
+	// HTTP APIs join repeated headers with commas, which can not be split
+	// back safely
+	multiValueHeaders := map[string][]string{}
+	for name, value := range event.Headers {
+		multiValueHeaders[name] = []string{value}
+	}
+
+	request := types.Request{
+		Method:                event.RequestContext.HTTP.Method,
+		Path:                  stripStage(event.RawPath, event.RequestContext.Stage),
+		Resource:              resource,
+		Headers:               event.Headers,
+		MultiValueHeaders:     multiValueHeaders,
+		QueryStringParameters: event.QueryStringParameters,
+		PathParameters:        event.PathParameters,
+		Cookies:               event.Cookies,
+		Body:                  decodeBody(event.Body, event.IsBase64Encoded),
+		RequestId:             event.RequestContext.RequestID,
+	}
+
+	if authorizer := event.RequestContext.Authorizer; authorizer != nil {
+		request.Authorizer = authorizer.Lambda
+		if authorizer.JWT != nil {
+			request.JwtClaims = authorizer.JWT.Claims
+			request.JwtScopes = authorizer.JWT.Scopes
+		}
+	}
+
+	return request
+}
+
+func NewRequestFromFunctionUrl(event events.LambdaFunctionURLRequest) types.Request {
+	multiValueHeaders := map[string][]string{}
+	for name, value := range event.Headers {
+		multiValueHeaders[name] = []string{value}
+	}
+
+	return types.Request{
+		Method:                event.RequestContext.HTTP.Method,
+		Path:                  event.RawPath,
+		Headers:               event.Headers,
+		MultiValueHeaders:     multiValueHeaders,
+		QueryStringParameters: event.QueryStringParameters,
+		Cookies:               event.Cookies,
+		Body:                  decodeBody(event.Body, event.IsBase64Encoded),
+		RequestId:             event.RequestContext.RequestID,
+	}
+}
+
+// ALBs send either headers or multiValueHeaders depending on the target
+// group setting and do not decode query parameters
+func NewRequestFromAlb(event events.ALBTargetGroupRequest) types.Request {
+	headers := event.Headers
+	multiValueHeaders := event.MultiValueHeaders
+	if multiValueHeaders != nil {
+		headers = map[string]string{}
+		for name, values := range multiValueHeaders {
+			if len(values) > 0 {
+				headers[name] = values[len(values)-1]
+			}
+		}
+	} else {
+		multiValueHeaders = map[string][]string{}
+		for name, value := range headers {
+			multiValueHeaders[name] = []string{value}
+		}
+	}
+
+	queryStringParameters := map[string]string{}
+	for name, value := range event.QueryStringParameters {
+		queryStringParameters[unescapeQuery(name)] = unescapeQuery(value)
+	}
+	for name, values := range event.MultiValueQueryStringParameters {
+		if len(values) > 0 {
+			queryStringParameters[unescapeQuery(name)] = unescapeQuery(values[len(values)-1])
+		}
+	}
+
+	cookies := []string{}
+	for name, values := range multiValueHeaders {
+		if !strings.EqualFold(name, "Cookie") {
+			continue
+		}
+		for _, header := range values {
+			cookies = append(cookies, splitCookieHeader(header)...)
+		}
+	}
+
+	return types.Request{
+		Method:                event.HTTPMethod,
+		Path:                  event.Path,
+		Headers:               headers,
+		MultiValueHeaders:     multiValueHeaders,
+		QueryStringParameters: queryStringParameters,
+		Cookies:               cookies,
+		Body:                  decodeBody(event.Body, event.IsBase64Encoded),
+		// ALBs do not assign request IDs, the trace header is the closest thing
+		RequestId: GetHeader(headers, "X-Amzn-Trace-Id"),
+	}
+}
+
+func unescapeQuery(value string) string {
+	unescaped, unescapeErr := url.QueryUnescape(value)
+	if unescapeErr != nil {
+		return value
+	}
+
+	return unescaped
+}
+
+func NewProxyResponse(res types.Response) events.APIGatewayProxyResponse {
+	multiValueHeaders := res.MultiValueHeaders
+	if len(res.Cookies) > 0 {
+		multiValueHeaders = map[string][]string{}
+		for name, values := range res.MultiValueHeaders {
+			multiValueHeaders[name] = values
+		}
+		multiValueHeaders["Set-Cookie"] = append(multiValueHeaders["Set-Cookie"], res.Cookies...)
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode:        res.StatusCode,
+		Headers:           res.Headers,
+		MultiValueHeaders: multiValueHeaders,
+		Body:              res.Body,
+		IsBase64Encoded:   res.IsBase64Encoded,
+	}
+}
+
+func NewV2Response(res types.Response) events.APIGatewayV2HTTPResponse {
+	headers, cookies := singleValueHeaders(res)
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:      res.StatusCode,
+		Headers:         headers,
+		Cookies:         cookies,
+		Body:            res.Body,
+		IsBase64Encoded: res.IsBase64Encoded,
+	}
+}
+
+func NewFunctionUrlResponse(res types.Response) events.LambdaFunctionURLResponse {
+	headers, cookies := singleValueHeaders(res)
+
+	return events.LambdaFunctionURLResponse{
+		StatusCode:      res.StatusCode,
+		Headers:         headers,
+		Cookies:         cookies,
+		Body:            res.Body,
+		IsBase64Encoded: res.IsBase64Encoded,
+	}
+}
+
+// Payload format 2.0 and function URLs ignore multiValueHeaders, so values
+// are comma-joined instead. Set-Cookie can't be joined and goes to cookies.
+func singleValueHeaders(res types.Response) (map[string]string, []string) {
+	headers := map[string]string{}
+	var cookies []string
+	cookies = append(cookies, res.Cookies...)
+	add := func(name string, values ...string) {
+		if strings.EqualFold(name, "Set-Cookie") {
+			cookies = append(cookies, values...)
+			return
+		}
+		if existing, exists := headers[name]; exists {
+			values = append([]string{existing}, values...)
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+
+	for name, value := range res.Headers {
+		add(name, value)
+	}
+	for name, values := range res.MultiValueHeaders {
+		if len(values) > 0 {
+			add(name, values...)
+		}
+	}
+
+	return headers, cookies
+}
+
+// multiValue has to match whether the target group sent multiValueHeaders
+func NewAlbResponse(res types.Response, multiValue bool) events.ALBTargetGroupResponse {
+	albRes := events.ALBTargetGroupResponse{
+		StatusCode:        res.StatusCode,
+		StatusDescription: fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode)),
+		Body:              res.Body,
+		IsBase64Encoded:   res.IsBase64Encoded,
+	}
+
+	if multiValue {
+		multiValueHeaders := map[string][]string{}
+		for name, value := range res.Headers {
+			multiValueHeaders[name] = []string{value}
+		}
+		for name, values := range res.MultiValueHeaders {
+			multiValueHeaders[name] = append(multiValueHeaders[name], values...)
+		}
+		if len(res.Cookies) > 0 {
+			multiValueHeaders["Set-Cookie"] = append(multiValueHeaders["Set-Cookie"], res.Cookies...)
+		}
+		albRes.MultiValueHeaders = multiValueHeaders
+		return albRes
+	}
+
+	headers := map[string]string{}
+	for name, values := range res.MultiValueHeaders {
+		headers[name] = strings.Join(values, ",")
+	}
+	for name, value := range res.Headers {
+		headers[name] = value
+	}
+	// Cookies can not be joined, so only the last one fits without
+	// multi-value headers
+	if len(res.Cookies) > 0 {
+		headers["Set-Cookie"] = res.Cookies[len(res.Cookies)-1]
+	}
+	albRes.Headers = headers
+
+	return albRes
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func TestNewV2Response(t *testing.T) {
+	tests := []struct {
+		name        string
+		res         types.Response
+		wantHeaders map[string]string
+		wantCookies []string
+	}{
+		{
+			name:        "single value headers",
+			res:         types.Response{Headers: map[string]string{"ETag": `"1"`}},
+			wantHeaders: map[string]string{"ETag": `"1"`},
+		},
+		{
+			name:        "multi-value headers are joined",
+			res:         types.Response{MultiValueHeaders: map[string][]string{"Vary": {"Origin", "Accept"}}},
+			wantHeaders: map[string]string{"Vary": "Origin,Accept"},
+		},
+		{
+			name: "both kinds of the same header",
+			res: types.Response{
+				Headers:           map[string]string{"Vary": "Origin"},
+				MultiValueHeaders: map[string][]string{"Vary": {"Accept"}},
+			},
+			wantHeaders: map[string]string{"Vary": "Origin,Accept"},
+		},
+		{
+			name: "Set-Cookie goes to cookies",
+			res: types.Response{
+				Headers:           map[string]string{"Set-Cookie": "a=1"},
+				MultiValueHeaders: map[string][]string{"set-cookie": {"b=2", "c=3"}},
+				Cookies:           []string{"d=4"},
+			},
+			wantHeaders: map[string]string{},
+			wantCookies: []string{"d=4", "a=1", "b=2", "c=3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := NewV2Response(tt.res)
+			if !reflect.DeepEqual(res.Headers, tt.wantHeaders) {
+				t.Errorf("got headers %v, want %v", res.Headers, tt.wantHeaders)
+			}
+			if !reflect.DeepEqual(res.Cookies, tt.wantCookies) {
+				t.Errorf("got cookies %v, want %v", res.Cookies, tt.wantCookies)
+			}
+			if res.MultiValueHeaders != nil {
+				t.Errorf("got multiValueHeaders %v, which payload format 2.0 ignores", res.MultiValueHeaders)
+			}
+		})
+	}
+}
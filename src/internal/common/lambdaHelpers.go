@@ -1,73 +1,92 @@
 package common
 
 import (
-	"context"
-	"encoding/json"
 	"errors"
-
-	"github.com/aws/aws-lambda-go/events"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/thomasstep/giphy-livechat-api/internal/types"
 )
 
-func LamdbaWrapper(handler types.HandlerSignature) types.HandlerSignature {
-	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-		res, err := handler(ctx, request)
-
-		// This value is also in config but can not be used here due to a circular dependency
-		corsAllowOriginHeader := GetEnv("CORS_ALLOW_ORIGIN_HEADER", "")
-
-		if err != nil {
-			var exstUsrErr *types.ExistingUsersError
-			var inErr *types.InputError
-			var missResErr *types.MissingResourceError
-			var missUsrErr *types.MissingUserIdError
-			var UnauthErr *types.UnauthorizedError
-			var ConflictErr *types.ConflictError
-			var IntErr *types.InternalError
-
-			var statusCode int
-			if errors.As(err, &exstUsrErr) {
-				statusCode = 409
-			} else if errors.As(err, &inErr) {
-				statusCode = 400
-			} else if errors.As(err, &missResErr) {
-				statusCode = 404
-			} else if errors.As(err, &missUsrErr) {
-				statusCode = 401
-			} else if errors.As(err, &UnauthErr) {
-				statusCode = 401
-			} else if errors.As(err, &ConflictErr) {
-				statusCode = 409
-			} else if errors.As(err, &IntErr) {
-				statusCode = 500
-			} else {
-				// If it's not a customer error, then let it fly
-				return events.APIGatewayProxyResponse{}, err
-			}
-
-			jsonBody, marshalErr := json.Marshal(&types.ErrorResponseStructure{
-				Message: err.Error(),
-			})
-			if marshalErr != nil {
-				return events.APIGatewayProxyResponse{}, marshalErr
-			}
-
-			return events.APIGatewayProxyResponse{
-				StatusCode: statusCode,
-				Body:       string(jsonBody),
-				Headers: map[string]string{
-					"Access-Control-Allow-Origin":      corsAllowOriginHeader,
-					"Access-Control-Allow-Credentials": "true",
-				},
-			}, nil
+// Header names are case-insensitive but API Gateway passes them through as sent
+func GetHeader(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
 		}
+	}
+
+	return ""
+}
+
+func FormatEtag(version int) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// Turns an If-Match header into the expectedVersion used by entity writes
+func ParseIfMatch(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return types.UnconditionalVersion, nil
+	}
+	if header == "*" {
+		return types.AnyVersion, nil
+	}
 
-		res.Headers = map[string]string{
-			"Access-Control-Allow-Origin":      corsAllowOriginHeader,
-			"Access-Control-Allow-Credentials": "true",
+	version, convErr := strconv.Atoi(strings.Trim(header, "\""))
+	// Items written before versioning are served with ETag "0"
+	if convErr != nil || version < 0 {
+		return types.UnconditionalVersion, &types.InputError{
+			Err: errors.New("If-Match must be * or an ETag returned by this API."),
 		}
+	}
 
-		return res, nil
+	return version, nil
+}
+
+// Turns the limit query string parameter into a page size. Missing limits
+// get maxLimit and larger ones are capped at it.
+func ParseLimit(rawLimit string, maxLimit int) (int, error) {
+	if rawLimit == "" {
+		return maxLimit, nil
 	}
+
+	limit, convErr := strconv.Atoi(rawLimit)
+	if convErr != nil || limit < 1 {
+		return 0, &types.InputError{
+			Err: errors.New("limit must be a positive integer."),
+		}
+	}
+
+	if limit > maxLimit {
+		return maxLimit, nil
+	}
+
+	return limit, nil
+}
+
+// Uses the weak comparison RFC 9110 requires for If-None-Match
+func MatchesIfNoneMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// True when lastModified is not after an If-Modified-Since header. Headers
+// that do not parse never match.
+func NotModifiedSince(header string, lastModified time.Time) bool {
+	since, parseErr := http.ParseTime(header)
+	if parseErr != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(since)
 }
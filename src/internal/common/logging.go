@@ -0,0 +1,126 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+var baseLogger *zap.Logger
+var onceBaseLogger sync.Once
+
+// The process wide JSON logger, which redacts secrets before writing. LOG_LEVEL
+// sets the minimum level and defaults to info. Code that has a context should log through
+// LoggerFromContext instead so its lines carry the invocation's fields.
+func Logger() *zap.Logger {
+	onceBaseLogger.Do(func() {
+		level, levelErr := zapcore.ParseLevel(GetEnv("LOG_LEVEL", "info"))
+		if levelErr != nil {
+			level = zapcore.InfoLevel
+		}
+
+		loggerConfig := zap.NewProductionConfig()
+		loggerConfig.Level = zap.NewAtomicLevelAt(level)
+		// Lambda already timestamps every line it ships to CloudWatch, but
+		// ISO 8601 is easier to read than epoch seconds
+		loggerConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		// Every line of an invocation matters when debugging it
+		loggerConfig.Sampling = nil
+		// RecoverMiddleware logs the stack that matters, the one of the panic
+		loggerConfig.DisableStacktrace = true
+
+		logger, buildErr := loggerConfig.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return &redactingCore{core}
+		}))
+		if buildErr != nil {
+			panic(buildErr)
+		}
+		baseLogger = logger
+	})
+
+	return baseLogger
+}
+
+type loggerContextKey struct{}
+
+func ContextWithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// Falls back to the base logger, tagged with the awsRequestId when there is
+// one, for contexts that did not go through InvocationLogger
+func LoggerFromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*zap.Logger); ok {
+		return logger
+	}
+
+	if requestId := awsRequestId(ctx); requestId != "" {
+		return Logger().With(zap.String("awsRequestId", requestId))
+	}
+	return Logger()
+}
+
+// Creates the child logger for one invocation and stores it in the returned
+// context. Lines carry the trace ID when ctx holds a span. Callers should FlushLogger it before returning.
+func InvocationLogger(ctx context.Context, fields ...zap.Field) (context.Context, *zap.Logger) {
+	logger := Logger().With(zap.String("awsRequestId", awsRequestId(ctx)))
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		logger = logger.With(zap.String("traceId", spanContext.TraceID().String()))
+	}
+	logger = logger.With(fields...)
+	return ContextWithLogger(ctx, logger), logger
+}
+
+// Lambda may freeze the process as soon as the handler returns, so buffered
+// lines have to be written before that
+func FlushLogger(logger *zap.Logger) {
+	// Syncing stdout fails on some platforms, there is nothing to do about it
+	_ = logger.Sync()
+}
+
+// Whoever the authorizer let in. Lambda authorizers set principalId and
+// JWT authorizers identify callers by their sub claim.
+func PrincipalOf(request types.Request) string {
+	if principalId, ok := request.Authorizer["principalId"]; ok {
+		return fmt.Sprint(principalId)
+	}
+
+	return request.JwtClaims["sub"]
+}
+
+// Puts a request-scoped logger into the context and logs one line per
+// request once it is handled. Runs first so every other middleware can use
+// LoggerFromContext.
+func LoggingMiddleware(next types.HandlerSignature) types.HandlerSignature {
+	return func(ctx context.Context, request types.Request) (types.Response, error) {
+		ctx, logger := InvocationLogger(ctx,
+			zap.String("requestId", request.RequestId),
+			zap.String("principal", PrincipalOf(request)),
+			zap.String("route", fmt.Sprintf("%s %s", request.Method, request.Resource)),
+		)
+		defer FlushLogger(logger)
+
+		start := time.Now()
+		res, err := next(ctx, request)
+		if err != nil {
+			logger.Error("Request failed",
+				zap.Error(err),
+				zap.Duration("duration", time.Since(start)),
+			)
+			return res, err
+		}
+
+		logger.Info("Handled request",
+			zap.Int("statusCode", res.StatusCode),
+			zap.Duration("duration", time.Since(start)),
+		)
+		return res, nil
+	}
+}
@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+)
+
+/*
+ * Metrics are written to stdout in CloudWatch Embedded Metric Format. Lambda
+ * ships stdout to CloudWatch Logs, which extracts the metrics, so nothing
+ * has to call the CloudWatch API.
+ *
+ * METRICS_NAMESPACE sets the namespace. METRICS_DIMENSIONS is a comma
+ * separated list of name=value pairs added to every metric and defaults to
+ * FunctionName=$AWS_LAMBDA_FUNCTION_NAME. METRICS_DISABLED=true turns
+ * metrics off.
+ */
+
+type Unit string
+
+const (
+	Milliseconds Unit = "Milliseconds"
+	Count        Unit = "Count"
+	None         Unit = "None"
+)
+
+type Dimensions map[string]string
+
+type Recorder interface {
+	Record(name string, value float64, unit Unit, dimensions Dimensions)
+}
+
+var recorder Recorder
+var onceRecorder sync.Once
+
+func GetRecorder() Recorder {
+	onceRecorder.Do(func() {
+		if common.GetEnv("METRICS_DISABLED", "false") == "true" {
+			recorder = NoopRecorder{}
+			return
+		}
+
+		recorder = NewEmfRecorder(
+			common.GetEnv("METRICS_NAMESPACE", "EntityApi"),
+			parseDimensions(common.GetEnv("METRICS_DIMENSIONS", "FunctionName="+common.GetEnv("AWS_LAMBDA_FUNCTION_NAME", ""))),
+			os.Stdout,
+		)
+	})
+
+	return recorder
+}
+
+// Replaces the recorder GetRecorder hands out. Only takes effect before the
+// first call to GetRecorder.
+func SetRecorder(r Recorder) {
+	onceRecorder.Do(func() {
+		recorder = r
+	})
+}
+
+// Pairs without a value are dropped, CloudWatch rejects empty dimensions
+func parseDimensions(list string) Dimensions {
+	dimensions := Dimensions{}
+	for _, pair := range strings.Split(list, ",") {
+		name, value, _ := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if name != "" && value != "" {
+			dimensions[name] = value
+		}
+	}
+
+	return dimensions
+}
+
+func Record(name string, value float64, unit Unit, dimensions Dimensions) {
+	GetRecorder().Record(name, value, unit, dimensions)
+}
+
+func RecordLatency(name string, start time.Time, dimensions Dimensions) {
+	Record(name, float64(time.Since(start).Microseconds())/1000, Milliseconds, dimensions)
+}
+
+func Increment(name string, dimensions Dimensions) {
+	Record(name, 1, Count, dimensions)
+}
+
+// Writes one EMF document per datapoint
+type EmfRecorder struct {
+	namespace  string
+	dimensions Dimensions
+	mu         sync.Mutex
+	out        io.Writer
+}
+
+func NewEmfRecorder(namespace string, dimensions Dimensions, out io.Writer) *EmfRecorder {
+	return &EmfRecorder{
+		namespace:  namespace,
+		dimensions: dimensions,
+		out:        out,
+	}
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+func (r *EmfRecorder) Record(name string, value float64, unit Unit, dimensions Dimensions) {
+	document := map[string]interface{}{}
+	dimensionNames := []string{}
+	for _, set := range []Dimensions{r.dimensions, dimensions} {
+		for dimension, dimensionValue := range set {
+			if _, seen := document[dimension]; !seen {
+				dimensionNames = append(dimensionNames, dimension)
+			}
+			document[dimension] = dimensionValue
+		}
+	}
+	sort.Strings(dimensionNames)
+
+	document[name] = value
+	document["_aws"] = emfMetadata{
+		Timestamp: time.Now().UnixMilli(),
+		CloudWatchMetrics: []emfDirective{
+			{
+				Namespace:  r.namespace,
+				Dimensions: [][]string{dimensionNames},
+				Metrics: []emfMetric{
+					{
+						Name: name,
+						Unit: unit,
+					},
+				},
+			},
+		},
+	}
+
+	// A map of strings, floats and plain structs always marshals
+	line, _ := json.Marshal(document)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.out.Write(append(line, '\n'))
+}
+
+type NoopRecorder struct{}
+
+func (NoopRecorder) Record(name string, value float64, unit Unit, dimensions Dimensions) {}
+
+type Datapoint struct {
+	Name       string
+	Value      float64
+	Unit       Unit
+	Dimensions Dimensions
+}
+
+// Keeps every datapoint in memory so tests can assert on them
+type MemoryRecorder struct {
+	mu         sync.Mutex
+	datapoints []Datapoint
+}
+
+func NewMemoryRecorder() *MemoryRecorder {
+	return &MemoryRecorder{}
+}
+
+func (r *MemoryRecorder) Record(name string, value float64, unit Unit, dimensions Dimensions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.datapoints = append(r.datapoints, Datapoint{
+		Name:       name,
+		Value:      value,
+		Unit:       unit,
+		Dimensions: dimensions,
+	})
+}
+
+// Every datapoint recorded under name, oldest first
+func (r *MemoryRecorder) Datapoints(name string) []Datapoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	datapoints := []Datapoint{}
+	for _, datapoint := range r.datapoints {
+		if datapoint.Name == name {
+			datapoints = append(datapoints, datapoint)
+		}
+	}
+
+	return datapoints
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+var testRecorder = NewMemoryRecorder()
+
+func TestMain(m *testing.M) {
+	SetRecorder(testRecorder)
+
+	os.Exit(m.Run())
+}
+
+func TestMemoryRecorder(t *testing.T) {
+	r := NewMemoryRecorder()
+	r.Record("Latency", 12.5, Milliseconds, Dimensions{"Route": "GET /v1/entity"})
+	r.Record("Responses", 1, Count, Dimensions{"StatusCode": "200"})
+	r.Record("Latency", 3, Milliseconds, nil)
+
+	tests := []struct {
+		name string
+		want []Datapoint
+	}{
+		{
+			name: "Latency",
+			want: []Datapoint{
+				{Name: "Latency", Value: 12.5, Unit: Milliseconds, Dimensions: Dimensions{"Route": "GET /v1/entity"}},
+				{Name: "Latency", Value: 3, Unit: Milliseconds},
+			},
+		},
+		{
+			name: "Responses",
+			want: []Datapoint{
+				{Name: "Responses", Value: 1, Unit: Count, Dimensions: Dimensions{"StatusCode": "200"}},
+			},
+		},
+		{
+			name: "Unrecorded",
+			want: []Datapoint{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Datapoints(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmfRecorder(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := NewEmfRecorder("TestApi", Dimensions{"FunctionName": "test"}, out)
+	r.Record("Responses", 1, Count, Dimensions{"StatusCode": "404"})
+
+	document := struct {
+		FunctionName string
+		StatusCode   string
+		Responses    float64
+		Aws          emfMetadata `json:"_aws"`
+	}{}
+	if jsonErr := json.Unmarshal(out.Bytes(), &document); jsonErr != nil {
+		t.Fatalf("output is not JSON: %v", jsonErr)
+	}
+
+	if document.FunctionName != "test" || document.StatusCode != "404" || document.Responses != 1 {
+		t.Errorf("got document %+v", document)
+	}
+	want := []emfDirective{
+		{
+			Namespace:  "TestApi",
+			Dimensions: [][]string{{"FunctionName", "StatusCode"}},
+			Metrics:    []emfMetric{{Name: "Responses", Unit: Count}},
+		},
+	}
+	if !reflect.DeepEqual(document.Aws.CloudWatchMetrics, want) {
+		t.Errorf("got directives %+v, want %+v", document.Aws.CloudWatchMetrics, want)
+	}
+}
+
+func TestParseDimensions(t *testing.T) {
+	tests := []struct {
+		list string
+		want Dimensions
+	}{
+		{list: "", want: Dimensions{}},
+		{list: "FunctionName=api", want: Dimensions{"FunctionName": "api"}},
+		{list: " Stage = prod , FunctionName=api", want: Dimensions{"Stage": "prod", "FunctionName": "api"}},
+		{list: "FunctionName=,Stage", want: Dimensions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			if got := parseDimensions(tt.list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		route      string
+		res        types.Response
+		err        error
+		wantStatus string
+	}{
+		{name: "response", route: "/v1/ok", res: types.Response{StatusCode: http.StatusCreated}, wantStatus: "201"},
+		{name: "failed invocation", route: "/v1/failed", err: errors.New("boom"), wantStatus: "502"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := func(ctx context.Context, request types.Request) (types.Response, error) {
+				return tt.res, tt.err
+			}
+			Middleware(next)(context.Background(), types.Request{Method: http.MethodPost, Resource: tt.route})
+
+			route := "POST " + tt.route
+			responses := []Datapoint{}
+			for _, datapoint := range testRecorder.Datapoints("Responses") {
+				if datapoint.Dimensions["Route"] == route {
+					responses = append(responses, datapoint)
+				}
+			}
+			if len(responses) != 1 || responses[0].Dimensions["StatusCode"] != tt.wantStatus || responses[0].Unit != Count {
+				t.Errorf("got Responses %+v, want one with status %s", responses, tt.wantStatus)
+			}
+
+			latencies := 0
+			for _, datapoint := range testRecorder.Datapoints("Latency") {
+				if datapoint.Dimensions["Route"] == route && datapoint.Unit == Milliseconds {
+					latencies++
+				}
+			}
+			if latencies != 1 {
+				t.Errorf("got %d Latency datapoints for %s, want 1", latencies, route)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Records Latency per route and Responses per route and status code.
+// Invocations that fail count as 502s, which is what API Gateway answers
+// with.
+func Middleware(next types.HandlerSignature) types.HandlerSignature {
+	return func(ctx context.Context, request types.Request) (types.Response, error) {
+		route := fmt.Sprintf("%s %s", request.Method, request.Resource)
+		start := time.Now()
+
+		res, err := next(ctx, request)
+
+		statusCode := res.StatusCode
+		if err != nil {
+			statusCode = http.StatusBadGateway
+		}
+
+		RecordLatency("Latency", start, Dimensions{
+			"Route": route,
+		})
+		Increment("Responses", Dimensions{
+			"Route":      route,
+			"StatusCode": strconv.Itoa(statusCode),
+		})
+
+		return res, err
+	}
+}
@@ -0,0 +1,179 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.uber.org/zap"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Middleware wraps a handler to run code before and after it
+type Middleware func(next types.HandlerSignature) types.HandlerSignature
+
+// Chain is an ordered list of middlewares. The first one is the outermost,
+// so it sees the request first and the response last.
+type Chain []Middleware
+
+func NewChain(middlewares ...Middleware) Chain {
+	return append(Chain{}, middlewares...)
+}
+
+// Returns a new chain, the receiver is left untouched
+func (c Chain) Append(middlewares ...Middleware) Chain {
+	chain := make(Chain, 0, len(c)+len(middlewares))
+	chain = append(chain, c...)
+	return append(chain, middlewares...)
+}
+
+func (c Chain) Then(handler types.HandlerSignature) types.HandlerSignature {
+	for i := len(c) - 1; i >= 0; i-- {
+		handler = c[i](handler)
+	}
+
+	return handler
+}
+
+// What every API handler runs behind unless it declares its own stack
+func DefaultChain() Chain {
+	return NewChain(
+		LoggingMiddleware,
+		CorsMiddleware,
+		ErrorMiddleware,
+		RecoverMiddleware,
+	)
+}
+
+// Lambda's ID for the invocation, which is what its logs are searchable by
+func awsRequestId(ctx context.Context) string {
+	lc, ok := lambdacontext.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	return lc.AwsRequestID
+}
+
+// Problem types resolve to pages under PROBLEM_TYPE_BASE_URL when it is set
+func problemType(code string) string {
+	// This value is also in config but can not be used here due to a circular dependency
+	baseUrl := GetEnv("PROBLEM_TYPE_BASE_URL", "")
+	if baseUrl == "" {
+		return "about:blank"
+	}
+
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(baseUrl, "/"), strings.ToLower(strings.ReplaceAll(code, "_", "-")))
+}
+
+// Messages of every error err wraps, which clients never see
+func errorCauses(err error) []string {
+	causes := []string{}
+	for cause := errors.Unwrap(err); cause != nil; cause = errors.Unwrap(cause) {
+		causes = append(causes, cause.Error())
+	}
+
+	return causes
+}
+
+// Turns types.ProblemError into application/problem+json responses. Any
+// other error is passed on and fails the invocation.
+func ErrorMiddleware(next types.HandlerSignature) types.HandlerSignature {
+	return func(ctx context.Context, request types.Request) (types.Response, error) {
+		res, err := next(ctx, request)
+		if err == nil {
+			return res, nil
+		}
+
+		var problemErr types.ProblemError
+		if !errors.As(err, &problemErr) {
+			if !errors.Is(err, context.DeadlineExceeded) {
+				// If it's not a customer error, then let it fly
+				return types.Response{}, err
+			}
+			// Still answer before Lambda kills the invocation
+			problemErr = &types.GatewayTimeoutError{
+				Err: err,
+			}
+			err = problemErr
+		}
+
+		if problemErr.Status() >= 500 {
+			LoggerFromContext(ctx).Error("Request failed",
+				zap.String("code", problemErr.Code()),
+				zap.Error(err),
+				zap.Strings("causes", errorCauses(err)),
+			)
+		}
+
+		problem := &types.ProblemDetails{
+			Type:      problemType(problemErr.Code()),
+			Title:     problemErr.Title(),
+			Status:    problemErr.Status(),
+			Detail:    problemErr.Error(),
+			Instance:  request.RequestId,
+			Code:      problemErr.Code(),
+			RequestId: awsRequestId(ctx),
+		}
+
+		var inErr *types.InputError
+		if errors.As(err, &inErr) {
+			problem.Violations = inErr.Violations
+		}
+
+		jsonBody, marshalErr := json.Marshal(problem)
+		if marshalErr != nil {
+			return types.Response{}, marshalErr
+		}
+
+		headers := map[string]string{
+			"Content-Type": "application/problem+json",
+		}
+
+		var methodErr *types.MethodNotAllowedError
+		if errors.As(err, &methodErr) {
+			headers["Allow"] = strings.Join(methodErr.Allowed, ", ")
+		}
+		var unavailErr *types.ServiceUnavailableError
+		if errors.As(err, &unavailErr) {
+			headers["Retry-After"] = strconv.Itoa(unavailErr.RetryAfter)
+		}
+
+		return types.Response{
+			StatusCode: problem.Status,
+			Body:       string(jsonBody),
+			Headers:    headers,
+		}, nil
+	}
+}
+
+// Turns a panic in next into an InternalError. Runs inside ErrorMiddleware so
+// the client still gets a problem response instead of API Gateway's 502.
+func RecoverMiddleware(next types.HandlerSignature) types.HandlerSignature {
+	return func(ctx context.Context, request types.Request) (res types.Response, err error) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			LoggerFromContext(ctx).Error("Recovered from panic",
+				zap.Any("panic", recovered),
+				zap.String("stack", string(debug.Stack())),
+			)
+
+			res = types.Response{}
+			err = &types.InternalError{
+				Err: fmt.Errorf("panic: %v", recovered),
+			}
+		}()
+
+		return next(ctx, request)
+	}
+}
@@ -0,0 +1,129 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func handlerReturning(res types.Response, err error) types.HandlerSignature {
+	return func(ctx context.Context, request types.Request) (types.Response, error) {
+		return res, err
+	}
+}
+
+func TestErrorMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantDetail  string
+		wantHeaders map[string]string
+		wantErr     bool
+	}{
+		{
+			name:       "input error with violations",
+			err:        &types.InputError{Err: errors.New("Invalid body."), Violations: []types.FieldViolation{{Field: "name", Rule: "required", Message: "name is required"}}},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   types.InvalidInputCode,
+			wantDetail: "Invalid body.",
+		},
+		{
+			name:       "wrapped missing resource",
+			err:        fmt.Errorf("reading entity: %w", &types.MissingResourceError{Err: errors.New("Could not find entity.")}),
+			wantStatus: http.StatusNotFound,
+			wantCode:   types.NotFoundCode,
+			wantDetail: "Could not find entity.",
+		},
+		{
+			name:        "method not allowed",
+			err:         &types.MethodNotAllowedError{Err: errors.New("Method not allowed."), Allowed: []string{http.MethodGet, http.MethodPut}},
+			wantStatus:  http.StatusMethodNotAllowed,
+			wantHeaders: map[string]string{"Allow": "GET, PUT"},
+		},
+		{
+			name:        "service unavailable",
+			err:         &types.ServiceUnavailableError{Err: errors.New("Try again later."), RetryAfter: 5},
+			wantStatus:  http.StatusServiceUnavailable,
+			wantHeaders: map[string]string{"Retry-After": "5"},
+		},
+		{
+			name:       "internal error hides its cause",
+			err:        &types.InternalError{Err: errors.New("database password is wrong")},
+			wantStatus: http.StatusInternalServerError,
+			wantDetail: "Internal Server Error",
+		},
+		{
+			name:       "deadline exceeded",
+			err:        fmt.Errorf("querying: %w", context.DeadlineExceeded),
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   types.GatewayTimeoutCode,
+		},
+		{
+			name:    "unhandled error",
+			err:     errors.New("boom"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := ErrorMiddleware(handlerReturning(types.Response{StatusCode: http.StatusOK}, tt.err))
+			res, err := handler(context.Background(), types.Request{RequestId: "request-1"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %d response, want the error passed on", res.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			if contentType := res.Headers["Content-Type"]; contentType != "application/problem+json" {
+				t.Errorf("got Content-Type %q, want application/problem+json", contentType)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := res.Headers[name]; got != want {
+					t.Errorf("got %s %q, want %q", name, got, want)
+				}
+			}
+
+			problem := types.ProblemDetails{}
+			if jsonErr := json.Unmarshal([]byte(res.Body), &problem); jsonErr != nil {
+				t.Fatalf("body is not JSON: %v", jsonErr)
+			}
+			if problem.Status != tt.wantStatus || problem.Type != "about:blank" || problem.Title == "" || problem.Instance != "request-1" {
+				t.Errorf("got problem %+v", problem)
+			}
+			if tt.wantCode != "" && problem.Code != tt.wantCode {
+				t.Errorf("got code %q, want %q", problem.Code, tt.wantCode)
+			}
+			if tt.wantDetail != "" && problem.Detail != tt.wantDetail {
+				t.Errorf("got detail %q, want %q", problem.Detail, tt.wantDetail)
+			}
+
+			var inErr *types.InputError
+			if errors.As(tt.err, &inErr) && len(problem.Violations) != len(inErr.Violations) {
+				t.Errorf("got violations %+v, want %+v", problem.Violations, inErr.Violations)
+			}
+		})
+	}
+}
+
+func TestErrorMiddlewarePassesResponses(t *testing.T) {
+	want := types.Response{StatusCode: http.StatusCreated, Body: "{}"}
+	res, err := ErrorMiddleware(handlerReturning(want, nil))(context.Background(), types.Request{})
+	if err != nil || res.StatusCode != want.StatusCode || res.Body != want.Body {
+		t.Errorf("got %+v, %v, want %+v", res, err, want)
+	}
+}
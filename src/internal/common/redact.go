@@ -0,0 +1,260 @@
+package common
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/*
+ * Every logger from Logger() scrubs what it writes:
+ *   - values of headers (and fields) named in redactedHeaders or
+ *     LOG_REDACT_HEADERS, e.g. Authorization and Cookie
+ *   - anything shaped like a JWT, wherever it shows up in a string
+ *   - struct fields tagged log:"sensitive"
+ * Values logged with zap.Any are rebuilt as plain maps and slices, so only
+ * exported fields make it into the log. Array and object marshalers (zap.Strings,
+ * zap.Object, ...) are encoded the same way before they are scrubbed.
+ * Numbers, bools, durations and times are written as they are.
+ */
+
+const redactedValue = "[REDACTED]"
+
+// Limits how deep Redact follows pointers, which also stops cycles
+const maxRedactDepth = 10
+
+var redactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"Idempotency-Key",
+}
+
+// Base64url header and payload that both start with {" followed by an
+// optional signature
+var jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+var redactedNames map[string]bool
+var onceRedactedNames sync.Once
+
+func isRedactedName(name string) bool {
+	onceRedactedNames.Do(func() {
+		redactedNames = map[string]bool{}
+		// This value can not come from config due to a circular dependency
+		configured := splitList(GetEnv("LOG_REDACT_HEADERS", ""))
+		for _, header := range append(redactedHeaders, configured...) {
+			redactedNames[strings.ToLower(header)] = true
+		}
+	})
+
+	return redactedNames[strings.ToLower(name)]
+}
+
+func redactString(value string) string {
+	return jwtPattern.ReplaceAllString(value, redactedValue)
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// Returns a copy of value that is safe to log
+func Redact(value interface{}) interface{} {
+	return redactValue(reflect.ValueOf(value), 0)
+}
+
+func redactValue(v reflect.Value, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if depth > maxRedactDepth {
+		return fmt.Sprintf("[%s]", v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), depth+1)
+	case reflect.String:
+		return redactString(v.String())
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Sprintf("[%s]", v.Type())
+		}
+		redacted := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if isRedactedName(key) {
+				redacted[key] = redactedValue
+				continue
+			}
+			redacted[key] = redactValue(iter.Value(), depth+1)
+		}
+		return redacted
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("[%d bytes]", v.Len())
+		}
+		redacted := make([]interface{}, v.Len())
+		for i := range redacted {
+			redacted[i] = redactValue(v.Index(i), depth+1)
+		}
+		return redacted
+	case reflect.Struct:
+		// Types like time.Time know how to present themselves
+		if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+			return v.Interface()
+		}
+		redacted := map[string]interface{}{}
+		redactStruct(v, redacted, depth)
+		return redacted
+	default:
+		if v.CanInterface() {
+			return v.Interface()
+		}
+		return nil
+	}
+}
+
+// Embedded structs are flattened into their parent the way encoding/json
+// does it
+func redactStruct(v reflect.Value, redacted map[string]interface{}, depth int) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		// Exported fields of unexported embedded structs are still promoted
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			redactStruct(v.Field(i), redacted, depth+1)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if field.Tag.Get("log") == "sensitive" || isRedactedName(name) {
+			redacted[name] = redactedValue
+			continue
+		}
+		redacted[name] = redactValue(v.Field(i), depth+1)
+	}
+}
+
+func redactField(field zapcore.Field) zapcore.Field {
+	if isRedactedName(field.Key) {
+		return zap.String(field.Key, redactedValue)
+	}
+
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = redactString(field.String)
+	case zapcore.ReflectType:
+		return zap.Reflect(field.Key, Redact(field.Interface))
+	case zapcore.StringerType:
+		return zap.String(field.Key, redactString(fmt.Sprint(field.Interface)))
+	case zapcore.ByteStringType:
+		if value, ok := field.Interface.([]byte); ok {
+			return zap.ByteString(field.Key, []byte(redactString(string(value))))
+		}
+	case zapcore.BinaryType:
+		return zap.Reflect(field.Key, Redact(field.Interface))
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok && err != nil {
+			message := redactString(err.Error())
+			if message != err.Error() {
+				return zap.String(field.Key, message)
+			}
+		}
+	case zapcore.ArrayMarshalerType, zapcore.ObjectMarshalerType, zapcore.InlineMarshalerType:
+		return redactMarshalerField(field)
+	}
+
+	return field
+}
+
+// Marshaler fields like zap.Strings and zap.Object only hand over their
+// values while being encoded, so they are encoded into a map first and the
+// result is redacted like anything from zap.Any
+func redactMarshalerField(field zapcore.Field) zapcore.Field {
+	encoder := zapcore.NewMapObjectEncoder()
+	field.AddTo(encoder)
+
+	if field.Type == zapcore.InlineMarshalerType {
+		return zap.Inline(redactedObject(redactEncodedFields(encoder.Fields)))
+	}
+
+	value, exists := encoder.Fields[field.Key]
+	if !exists {
+		// Encoding failed and zap recorded the error under <key>Error instead
+		return zap.String(field.Key+"Error", redactString(fmt.Sprint(encoder.Fields[field.Key+"Error"])))
+	}
+
+	return zap.Reflect(field.Key, Redact(value))
+}
+
+func redactEncodedFields(fields map[string]interface{}) map[string]interface{} {
+	redacted, _ := Redact(fields).(map[string]interface{})
+	return redacted
+}
+
+// A redacted inline object that zap can flatten back into its parent
+type redactedObject map[string]interface{}
+
+func (o redactedObject) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	for key, value := range o {
+		if reflectErr := encoder.AddReflected(key, value); reflectErr != nil {
+			return reflectErr
+		}
+	}
+
+	return nil
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = redactField(field)
+	}
+
+	return redacted
+}
+
+// Wraps the core every logger writes through so every field, including
+// those added with With, is passed through redactField
+type redactingCore struct {
+	zapcore.Core
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{c.Core.With(redactFields(fields))}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = redactString(entry.Message)
+	return c.Core.Write(entry, redactFields(fields))
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"context"
+	"errors"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+type Route struct {
+	Method string
+	// API Gateway resource path, e.g. /v1/entity/{entityId}
+	Resource string
+	Handler  types.HandlerSignature
+}
+
+// Returns one handler that serves every route. Requests are matched on
+// their path rather than request.Resource because a single Lambda sits
+// behind a catch-all resource like /{proxy+}. Paths that match no resource
+// get a 404 and known resources with another method get a 405. Preflight
+// requests go to the route they ask about so its CORS policy answers them.
+func NewRouter(routes []Route) types.HandlerSignature {
+	notFoundHandler := DefaultChain().Then(func(ctx context.Context, request types.Request) (types.Response, error) {
+		return types.Response{}, &types.MissingResourceError{
+			Err: errors.New("Not Found"),
+		}
+	})
+
+	return func(ctx context.Context, request types.Request) (types.Response, error) {
+		method := request.Method
+		if IsPreflight(request) {
+			method = GetHeader(request.Headers, "Access-Control-Request-Method")
+		}
+
+		allowedMethods := []string{}
+		for _, route := range routes {
+			pathParameters, matched := MatchResource(route.Resource, request.Path)
+			if !matched {
+				continue
+			}
+			if route.Method != method {
+				allowedMethods = append(allowedMethods, route.Method)
+				continue
+			}
+
+			request.Resource = route.Resource
+			request.PathParameters = pathParameters
+			return route.Handler(ctx, request)
+		}
+
+		if len(allowedMethods) == 0 {
+			return notFoundHandler(ctx, request)
+		}
+
+		methodNotAllowedHandler := DefaultChain().Then(func(ctx context.Context, request types.Request) (types.Response, error) {
+			return types.Response{}, &types.MethodNotAllowedError{
+				Err:     errors.New("Method Not Allowed"),
+				Allowed: allowedMethods,
+			}
+		})
+		return methodNotAllowedHandler(ctx, request)
+	}
+}
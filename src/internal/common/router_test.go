@@ -0,0 +1,65 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func v2Event(method string, rawPath string, stage string) events.APIGatewayV2HTTPRequest {
+	event := events.APIGatewayV2HTTPRequest{
+		RouteKey: "$default",
+		RawPath:  rawPath,
+	}
+	event.RequestContext.HTTP.Method = method
+	event.RequestContext.Stage = stage
+
+	return event
+}
+
+func TestNewRouter(t *testing.T) {
+	routes := []Route{
+		{
+			Method:   http.MethodGet,
+			Resource: "/v1/entity/{entityId}",
+			Handler: func(ctx context.Context, request types.Request) (types.Response, error) {
+				return types.Response{StatusCode: http.StatusOK, Body: request.PathParameters["entityId"]}, nil
+			},
+		},
+	}
+	router := NewRouter(routes)
+
+	tests := []struct {
+		name       string
+		event      events.APIGatewayV2HTTPRequest
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "default stage", event: v2Event(http.MethodGet, "/v1/entity/1234", "$default"), wantStatus: http.StatusOK, wantBody: "1234"},
+		{name: "named stage", event: v2Event(http.MethodGet, "/prod/v1/entity/1234", "prod"), wantStatus: http.StatusOK, wantBody: "1234"},
+		{name: "custom domain without the stage in the path", event: v2Event(http.MethodGet, "/v1/entity/1234", "prod"), wantStatus: http.StatusOK, wantBody: "1234"},
+		{name: "stage alone", event: v2Event(http.MethodGet, "/prod", "prod"), wantStatus: http.StatusNotFound},
+		{name: "unknown path", event: v2Event(http.MethodGet, "/prod/v1/other", "prod"), wantStatus: http.StatusNotFound},
+		{name: "other method", event: v2Event(http.MethodPost, "/prod/v1/entity/1234", "prod"), wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := router(context.Background(), NewRequestFromV2(tt.event))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			if tt.wantBody != "" && res.Body != tt.wantBody {
+				t.Errorf("got body %q, want %q", res.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Wraps the invocation in a server span and flushes it once the response
+// is ready. Runs first so every other middleware is inside the span.
+func Middleware(next types.HandlerSignature) types.HandlerSignature {
+	return func(ctx context.Context, request types.Request) (types.Response, error) {
+		defer Flush(ctx)
+
+		invocationId := ""
+		if lc, ok := lambdacontext.FromContext(ctx); ok {
+			invocationId = lc.AwsRequestID
+		}
+
+		ctx, span := StartInvocation(ctx, fmt.Sprintf("%s %s", request.Method, request.Resource), trace.SpanKindServer, HeaderCarrier(request.Headers),
+			trace.WithAttributes(
+				semconv.FaaSTriggerHTTP,
+				semconv.FaaSInvocationID(invocationId),
+				semconv.HTTPRequestMethodKey.String(request.Method),
+				semconv.HTTPRoute(request.Resource),
+				semconv.URLPath(request.Path),
+			),
+		)
+		defer span.End()
+
+		res, err := next(ctx, request)
+		if err != nil {
+			RecordError(span, err)
+			return res, err
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+		if res.StatusCode >= 500 {
+			RecordError(span, fmt.Errorf("responded with %d", res.StatusCode))
+		}
+
+		return res, nil
+	}
+}
@@ -0,0 +1,158 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+ * Spans use X-Ray compatible IDs and are exported over OTLP/HTTP when
+ * OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set,
+ * e.g. to the collector of the ADOT Lambda layer. Without an endpoint spans
+ * are still created, so trace context keeps flowing, but nothing is
+ * exported.
+ *
+ * Trace context is read from and written to both traceparent and
+ * X-Amzn-Trace-Id.
+ */
+
+const instrumentationName = "github.com/thomasstep/giphy-livechat-api"
+
+var provider *sdktrace.TracerProvider
+var onceProvider sync.Once
+
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	xray.Propagator{},
+)
+
+func GetTracerProvider() *sdktrace.TracerProvider {
+	onceProvider.Do(func() {
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+			provider = NewTracerProvider()
+			return
+		}
+
+		// Reads the rest of its settings from OTEL_EXPORTER_OTLP_* as well
+		exporter, exporterErr := otlptracehttp.New(context.Background())
+		if exporterErr != nil {
+			panic(exporterErr)
+		}
+		// Lambda freezes the process between invocations, Flush exports
+		// whatever is batched before that
+		provider = NewTracerProvider(sdktrace.WithBatcher(exporter))
+	})
+
+	return provider
+}
+
+// Replaces the provider GetTracerProvider hands out. Only takes effect
+// before the first call to GetTracerProvider.
+func SetTracerProvider(tp *sdktrace.TracerProvider) {
+	onceProvider.Do(func() {
+		provider = tp
+	})
+}
+
+func NewTracerProvider(options ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	functionName := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	res, _ := resource.New(context.Background(),
+		resource.WithAttributes(
+			semconv.ServiceName(functionName),
+			semconv.FaaSName(functionName),
+		),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+
+	return sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{
+		sdktrace.WithIDGenerator(xray.NewIDGenerator()),
+		sdktrace.WithResource(res),
+	}, options...)...)
+}
+
+func Tracer() trace.Tracer {
+	return GetTracerProvider().Tracer(instrumentationName)
+}
+
+func Propagator() propagation.TextMapPropagator {
+	return propagator
+}
+
+// Exports every ended span. Called at the end of each invocation.
+func Flush(ctx context.Context) {
+	// Tracing must never fail a request
+	_ = GetTracerProvider().ForceFlush(ctx)
+}
+
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// HTTP header names are case-insensitive but the propagators look them up
+// with fixed casing
+type HeaderCarrier map[string]string
+
+func (c HeaderCarrier) Get(key string) string {
+	for name, value := range c {
+		if strings.EqualFold(name, key) {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func (c HeaderCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// The Lambda runtime passes the trace header of the invocation in the
+// context and in _X_AMZN_TRACE_ID
+func lambdaTraceHeader(ctx context.Context) string {
+	if header, ok := ctx.Value("x-amzn-trace-id").(string); ok && header != "" {
+		return header
+	}
+
+	return os.Getenv("_X_AMZN_TRACE_ID")
+}
+
+// Starts the span covering one invocation. Its parent comes from carrier,
+// e.g. the request headers or SNS message attributes, and otherwise from
+// the Lambda trace header.
+func StartInvocation(ctx context.Context, name string, kind trace.SpanKind, carrier propagation.TextMapCarrier, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parentCtx := propagator.Extract(ctx, carrier)
+	if !trace.SpanContextFromContext(parentCtx).IsValid() {
+		parentCtx = xray.Propagator{}.Extract(ctx, HeaderCarrier{
+			"X-Amzn-Trace-Id": lambdaTraceHeader(ctx),
+		})
+	}
+
+	return Tracer().Start(parentCtx, name, append([]trace.SpanStartOption{trace.WithSpanKind(kind)}, options...)...)
+}
@@ -0,0 +1,165 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common/tracing"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/tracing/tracingtest"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+var exporter *tracetest.InMemoryExporter
+
+func TestMain(m *testing.M) {
+	provider, inMemoryExporter := tracingtest.NewInMemoryTracerProvider()
+	tracing.SetTracerProvider(provider)
+	exporter = inMemoryExporter
+
+	os.Exit(m.Run())
+}
+
+func attributeValue(span tracetest.SpanStub, key string) string {
+	for _, attribute := range span.Attributes {
+		if string(attribute.Key) == key {
+			return attribute.Value.Emit()
+		}
+	}
+
+	return ""
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		res          types.Response
+		err          error
+		wantTraceId  string
+		wantParentId string
+		wantStatus   codes.Code
+	}{
+		{
+			name:       "new trace",
+			res:        types.Response{StatusCode: http.StatusOK},
+			wantStatus: codes.Unset,
+		},
+		{
+			name:         "traceparent",
+			headers:      map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			res:          types.Response{StatusCode: http.StatusOK},
+			wantTraceId:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantParentId: "00f067aa0ba902b7",
+			wantStatus:   codes.Unset,
+		},
+		{
+			name:         "X-Amzn-Trace-Id in any casing",
+			headers:      map[string]string{"x-amzn-trace-id": "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"},
+			res:          types.Response{StatusCode: http.StatusOK},
+			wantTraceId:  "5759e988bd862e3fe1be46a994272793",
+			wantParentId: "53995c3f42cd8ad8",
+			wantStatus:   codes.Unset,
+		},
+		{
+			name:       "server error response",
+			res:        types.Response{StatusCode: http.StatusServiceUnavailable},
+			wantStatus: codes.Error,
+		},
+		{
+			name:       "failed invocation",
+			err:        errors.New("boom"),
+			wantStatus: codes.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			// Outside Lambda nothing else may provide a parent
+			t.Setenv("_X_AMZN_TRACE_ID", "")
+
+			var handlerSpan trace.SpanContext
+			next := func(ctx context.Context, request types.Request) (types.Response, error) {
+				_, span := tracing.Tracer().Start(ctx, "handler")
+				handlerSpan = span.SpanContext()
+				span.End()
+				return tt.res, tt.err
+			}
+
+			tracing.Middleware(next)(context.Background(), types.Request{
+				Method:   http.MethodGet,
+				Path:     "/v1/entity/1234",
+				Resource: "/v1/entity/{entityId}",
+				Headers:  tt.headers,
+			})
+
+			spans := exporter.GetSpans()
+			if len(spans) != 2 {
+				t.Fatalf("got %d spans, want the handler's and the invocation's", len(spans))
+			}
+			invocation := spans[1]
+
+			if invocation.Name != "GET /v1/entity/{entityId}" || invocation.SpanKind != trace.SpanKindServer {
+				t.Errorf("got %s span %q", invocation.SpanKind, invocation.Name)
+			}
+			if route := attributeValue(invocation, string(semconv.HTTPRouteKey)); route != "/v1/entity/{entityId}" {
+				t.Errorf("got http.route %q", route)
+			}
+			if invocation.Status.Code != tt.wantStatus {
+				t.Errorf("got status %s, want %s", invocation.Status.Code, tt.wantStatus)
+			}
+			if tt.err == nil {
+				if statusCode := attributeValue(invocation, string(semconv.HTTPResponseStatusCodeKey)); statusCode == "" {
+					t.Error("response status code was not recorded")
+				}
+			}
+
+			// Spans started by the handler belong to the invocation
+			if handlerSpan.TraceID() != invocation.SpanContext.TraceID() || spans[0].Parent.SpanID() != invocation.SpanContext.SpanID() {
+				t.Error("handler span is not a child of the invocation span")
+			}
+
+			if tt.wantTraceId == "" {
+				if invocation.Parent.IsValid() {
+					t.Errorf("got parent %s, want a new trace", invocation.Parent.SpanID())
+				}
+				return
+			}
+			if traceId := invocation.SpanContext.TraceID().String(); traceId != tt.wantTraceId {
+				t.Errorf("got trace %s, want %s", traceId, tt.wantTraceId)
+			}
+			if parentId := invocation.Parent.SpanID().String(); parentId != tt.wantParentId {
+				t.Errorf("got parent %s, want %s", parentId, tt.wantParentId)
+			}
+		})
+	}
+}
+
+func TestHeaderCarrier(t *testing.T) {
+	carrier := tracing.HeaderCarrier{"TraceParent": "value"}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "traceparent", want: "value"},
+		{key: "TRACEPARENT", want: "value"},
+		{key: "tracestate", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := carrier.Get(tt.key); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package tracingtest
+
+import (
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common/tracing"
+)
+
+/*
+ * Helpers for tests that look at spans. They live apart from the tracing
+ * package so tracetest is not linked into the Lambda binaries.
+ */
+
+// Spans show up in the exporter as soon as they end
+func NewInMemoryTracerProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return tracing.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
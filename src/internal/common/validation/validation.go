@@ -0,0 +1,273 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+/*
+ * Request bodies are decoded strictly and then checked against the rules in
+ * each struct field's validate tag, e.g.
+ *
+ *   Name string `json:"name" validate:"required,maxLength=256,pattern=^\\S.*$"`
+ *
+ * Tags are Go string literals, so backslashes in patterns are doubled.
+ *
+ * Rules:
+ *   required        the field must be present and not its zero value
+ *   maxLength=<n>   strings may have at most n characters
+ *   pattern=<re>    strings must match re; it has to be the last rule since
+ *                   the expression may contain commas
+ *
+ * Every failure is collected and returned in one InputError so clients can
+ * fix all of them at once.
+ */
+
+// Default limit for DecodeJson, well below what API Gateway accepts
+const MaxBodyBytes = 64 * 1024
+
+type fieldRules struct {
+	index     int
+	name      string
+	required  bool
+	maxLength int
+	pattern   *regexp.Regexp
+}
+
+var rulesCache sync.Map
+
+func invalidBody(message string, violations []types.FieldViolation) error {
+	return &types.InputError{
+		Err:        errors.New(message),
+		Violations: violations,
+	}
+}
+
+// Decodes a JSON request body into target, which must be a pointer to a
+// struct, and validates it. Unknown fields, trailing data and bodies over
+// MaxBodyBytes are rejected.
+func DecodeJson(body string, target interface{}) error {
+	if len(body) > MaxBodyBytes {
+		return invalidBody(fmt.Sprintf("Request body must be at most %d bytes.", MaxBodyBytes), nil)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	decodeErr := decoder.Decode(target)
+	if decodeErr != nil {
+		return decodeError(decodeErr)
+	}
+
+	// Only whitespace may follow the object
+	if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+		return invalidBody("Request body must contain a single JSON object.", nil)
+	}
+
+	return Validate(target, rawFields(body))
+}
+
+// Turns encoding/json errors into messages that do not leak Go types
+func decodeError(decodeErr error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(decodeErr, &typeErr) {
+		return invalidBody("Request body is invalid.", []types.FieldViolation{
+			{
+				Field:   typeErr.Field,
+				Rule:    "type",
+				Message: fmt.Sprintf("must be a %s", jsonTypeName(typeErr.Type)),
+			},
+		})
+	}
+
+	// encoding/json has no typed error for this one
+	message := decodeErr.Error()
+	if strings.HasPrefix(message, "json: unknown field ") {
+		field, _ := strconv.Unquote(strings.TrimPrefix(message, "json: unknown field "))
+		return invalidBody("Request body is invalid.", []types.FieldViolation{
+			{
+				Field:   field,
+				Rule:    "unknown",
+				Message: "is not allowed",
+			},
+		})
+	}
+
+	return invalidBody("Request body must be valid JSON.", nil)
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Top level keys present in the body, so required can tell a missing field
+// from one sent as its zero value. Keys are lowercased because
+// encoding/json matches them to fields case-insensitively.
+func rawFields(body string) map[string]bool {
+	raw := map[string]json.RawMessage{}
+	if json.Unmarshal([]byte(body), &raw) != nil {
+		return nil
+	}
+
+	present := map[string]bool{}
+	for key, value := range raw {
+		key = strings.ToLower(key)
+		present[key] = present[key] || !bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+	}
+
+	return present
+}
+
+// Checks target against its validate tags. present lists the lowercased JSON
+// keys that were sent and may be nil when target was not decoded from JSON.
+func Validate(target interface{}, present map[string]bool) error {
+	value := reflect.Indirect(reflect.ValueOf(target))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	rules, rulesErr := getRules(value.Type())
+	if rulesErr != nil {
+		return rulesErr
+	}
+
+	violations := []types.FieldViolation{}
+	for _, rule := range rules {
+		field := value.Field(rule.index)
+
+		if rule.required {
+			sent := present == nil || present[strings.ToLower(rule.name)]
+			if !sent || field.IsZero() {
+				violations = append(violations, types.FieldViolation{
+					Field:   rule.name,
+					Rule:    "required",
+					Message: "is required",
+				})
+				continue
+			}
+		}
+
+		if field.Kind() != reflect.String {
+			continue
+		}
+		text := field.String()
+
+		if rule.maxLength > 0 && utf8.RuneCountInString(text) > rule.maxLength {
+			violations = append(violations, types.FieldViolation{
+				Field:   rule.name,
+				Rule:    "maxLength",
+				Message: fmt.Sprintf("must be at most %d characters", rule.maxLength),
+			})
+		}
+
+		if rule.pattern != nil && text != "" && !rule.pattern.MatchString(text) {
+			violations = append(violations, types.FieldViolation{
+				Field:   rule.name,
+				Rule:    "pattern",
+				Message: fmt.Sprintf("must match %s", rule.pattern.String()),
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return invalidBody("Request body is invalid.", violations)
+	}
+
+	return nil
+}
+
+func getRules(structType reflect.Type) ([]fieldRules, error) {
+	if cached, exists := rulesCache.Load(structType); exists {
+		return cached.([]fieldRules), nil
+	}
+
+	rules := []fieldRules{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag, hasTag := field.Tag.Lookup("validate")
+		if !hasTag {
+			continue
+		}
+
+		rule, parseErr := parseRules(tag)
+		if parseErr != nil {
+			// A bad tag is a programming error, not the client's fault
+			return nil, &types.InternalError{
+				Err: fmt.Errorf("invalid validate tag on %s.%s: %w", structType.Name(), field.Name, parseErr),
+			}
+		}
+		rule.index = i
+		rule.name = jsonName(field)
+		rules = append(rules, rule)
+	}
+
+	rulesCache.Store(structType, rules)
+	return rules, nil
+}
+
+func parseRules(tag string) (fieldRules, error) {
+	rule := fieldRules{}
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "pattern=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, argument, _ := strings.Cut(part, "=")
+		switch name {
+		case "required":
+			rule.required = true
+		case "maxLength":
+			maxLength, convErr := strconv.Atoi(argument)
+			if convErr != nil || maxLength < 1 {
+				return rule, fmt.Errorf("maxLength needs a positive integer, got %q", argument)
+			}
+			rule.maxLength = maxLength
+		case "pattern":
+			pattern, compileErr := regexp.Compile(argument)
+			if compileErr != nil {
+				return rule, compileErr
+			}
+			rule.pattern = pattern
+		default:
+			return rule, fmt.Errorf("unknown rule %q", name)
+		}
+	}
+
+	return rule, nil
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+
+	return name
+}
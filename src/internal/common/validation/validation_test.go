@@ -0,0 +1,269 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+type testBody struct {
+	Name  string `json:"name" validate:"required,maxLength=5"`
+	Code  string `json:"code,omitempty" validate:"pattern=^[a-z]{1,3}(,[a-z]+)?$"`
+	Count int    `json:"count" validate:"required"`
+	Note  string `json:"note"`
+	Flag  bool   `json:"flag"`
+}
+
+// Just the field and rule of every violation, in order
+func violationsOf(t *testing.T, err error) []string {
+	t.Helper()
+
+	var inErr *types.InputError
+	if !errors.As(err, &inErr) {
+		t.Fatalf("got error %v (%T), want an InputError", err, err)
+	}
+
+	violations := []string{}
+	for _, violation := range inErr.Violations {
+		violations = append(violations, violation.Field+":"+violation.Rule)
+	}
+
+	return violations
+}
+
+func TestDecodeJson(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		wantErr        bool
+		wantMessage    string
+		wantViolations []string
+		want           testBody
+	}{
+		{
+			name: "valid",
+			body: `{"name":"abc","code":"ab,cd","count":2}`,
+			want: testBody{Name: "abc", Code: "ab,cd", Count: 2},
+		},
+		{
+			name: "keys match case-insensitively",
+			body: `{"NAME":"abc","Count":1}`,
+			want: testBody{Name: "abc", Count: 1},
+		},
+		{
+			name: "trailing whitespace",
+			body: "{\"name\":\"abc\",\"count\":1}\n\t ",
+			want: testBody{Name: "abc", Count: 1},
+		},
+		{
+			name:           "missing required fields",
+			body:           `{}`,
+			wantErr:        true,
+			wantViolations: []string{"name:required", "count:required"},
+		},
+		{
+			name:           "required fields sent as null",
+			body:           `{"name":null,"count":null}`,
+			wantErr:        true,
+			wantViolations: []string{"name:required", "count:required"},
+		},
+		{
+			name:           "required fields sent as zero values",
+			body:           `{"name":"","count":0}`,
+			wantErr:        true,
+			wantViolations: []string{"name:required", "count:required"},
+		},
+		{
+			name:           "maxLength counts characters, not bytes",
+			body:           `{"name":"ääääää","count":1}`,
+			wantErr:        true,
+			wantViolations: []string{"name:maxLength"},
+		},
+		{
+			name: "maxLength at the limit",
+			body: `{"name":"äääää","count":1}`,
+			want: testBody{Name: "äääää", Count: 1},
+		},
+		{
+			name:           "pattern",
+			body:           `{"name":"abc","code":"ABC","count":1}`,
+			wantErr:        true,
+			wantViolations: []string{"code:pattern"},
+		},
+		{
+			name: "pattern is skipped for empty strings",
+			body: `{"name":"abc","code":"","count":1}`,
+			want: testBody{Name: "abc", Count: 1},
+		},
+		{
+			name:           "every violation is reported",
+			body:           `{"name":"abcdef","code":"1","count":0}`,
+			wantErr:        true,
+			wantViolations: []string{"name:maxLength", "code:pattern", "count:required"},
+		},
+		{
+			name:           "unknown field",
+			body:           `{"name":"abc","count":1,"admin":true}`,
+			wantErr:        true,
+			wantViolations: []string{"admin:unknown"},
+		},
+		{
+			name:           "wrong type",
+			body:           `{"name":"abc","count":"many"}`,
+			wantErr:        true,
+			wantViolations: []string{"count:type"},
+		},
+		{
+			name:        "trailing data",
+			body:        `{"name":"abc","count":1}{"name":"def"}`,
+			wantErr:     true,
+			wantMessage: "Request body must contain a single JSON object.",
+		},
+		{
+			name:        "not JSON",
+			body:        `{"name":`,
+			wantErr:     true,
+			wantMessage: "Request body must be valid JSON.",
+		},
+		{
+			name:        "empty body",
+			body:        ``,
+			wantErr:     true,
+			wantMessage: "Request body must be valid JSON.",
+		},
+		{
+			name:        "too large",
+			body:        `{"note":"` + strings.Repeat("a", MaxBodyBytes) + `"}`,
+			wantErr:     true,
+			wantMessage: "Request body must be at most 65536 bytes.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body testBody
+			decodeErr := DecodeJson(tt.body, &body)
+			if !tt.wantErr {
+				if decodeErr != nil {
+					t.Fatalf("unexpected error: %v", decodeErr)
+				}
+				if body != tt.want {
+					t.Errorf("got %+v, want %+v", body, tt.want)
+				}
+				return
+			}
+
+			violations := violationsOf(t, decodeErr)
+			if tt.wantViolations == nil {
+				tt.wantViolations = []string{}
+			}
+			if !reflect.DeepEqual(violations, tt.wantViolations) {
+				t.Errorf("got violations %v, want %v", violations, tt.wantViolations)
+			}
+			if tt.wantMessage != "" && decodeErr.Error() != tt.wantMessage {
+				t.Errorf("got message %q, want %q", decodeErr.Error(), tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestDecodeJsonTypeMessage(t *testing.T) {
+	var body testBody
+	decodeErr := DecodeJson(`{"name":"abc","count":1,"flag":"yes"}`, &body)
+
+	var inErr *types.InputError
+	if !errors.As(decodeErr, &inErr) || len(inErr.Violations) != 1 {
+		t.Fatalf("got error %v, want one violation", decodeErr)
+	}
+	// Go type names never reach clients
+	if message := inErr.Violations[0].Message; message != "must be a boolean" {
+		t.Errorf("got message %q, want %q", message, "must be a boolean")
+	}
+}
+
+func TestValidateWithoutJson(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           testBody
+		wantViolations []string
+	}{
+		{name: "valid", body: testBody{Name: "abc", Count: 1}},
+		{name: "zero values", body: testBody{}, wantViolations: []string{"name:required", "count:required"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validateErr := Validate(&tt.body, nil)
+			if tt.wantViolations == nil {
+				if validateErr != nil {
+					t.Fatalf("unexpected error: %v", validateErr)
+				}
+				return
+			}
+
+			if violations := violationsOf(t, validateErr); !reflect.DeepEqual(violations, tt.wantViolations) {
+				t.Errorf("got violations %v, want %v", violations, tt.wantViolations)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		tag           string
+		wantErr       bool
+		wantRequired  bool
+		wantMaxLength int
+		wantPattern   string
+	}{
+		{tag: "required", wantRequired: true},
+		{tag: "required,maxLength=10", wantRequired: true, wantMaxLength: 10},
+		{tag: "maxLength=3,pattern=^a,b$", wantMaxLength: 3, wantPattern: "^a,b$"},
+		// Everything after pattern= belongs to the expression
+		{tag: "pattern=^a$,required", wantPattern: "^a$,required"},
+		{tag: "maxLength=0", wantErr: true},
+		{tag: "maxLength=ten", wantErr: true},
+		{tag: "pattern=(", wantErr: true},
+		{tag: "minLength=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			rule, parseErr := parseRules(tt.tag)
+			if tt.wantErr {
+				if parseErr == nil {
+					t.Fatalf("got %+v, want an error", rule)
+				}
+				return
+			}
+			if parseErr != nil {
+				t.Fatalf("unexpected error: %v", parseErr)
+			}
+
+			pattern := ""
+			if rule.pattern != nil {
+				pattern = rule.pattern.String()
+			}
+			if rule.required != tt.wantRequired || rule.maxLength != tt.wantMaxLength || pattern != tt.wantPattern {
+				t.Errorf("got %+v with pattern %q", rule, pattern)
+			}
+		})
+	}
+}
+
+func TestInvalidTagIsInternalError(t *testing.T) {
+	type badBody struct {
+		Name string `json:"name" validate:"maxLength=none"`
+	}
+
+	var body badBody
+	decodeErr := DecodeJson(`{"name":"abc"}`, &body)
+
+	var internalErr *types.InternalError
+	if !errors.As(decodeErr, &internalErr) {
+		t.Fatalf("got error %v (%T), want an InternalError", decodeErr, decodeErr)
+	}
+}
@@ -0,0 +1,21 @@
+package chain
+
+import (
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/metrics"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/tracing"
+)
+
+// The middlewares every API handler runs behind, outermost first. Routes
+// only differ in their CORS policy, e.g. in the headers they expose.
+// Lives apart from common because metrics and tracing import common.
+func NewApiChain(cors common.CorsPolicy) common.Chain {
+	return common.NewChain(
+		tracing.Middleware,
+		common.LoggingMiddleware,
+		metrics.Middleware,
+		common.NewCorsMiddleware(cors),
+		common.ErrorMiddleware,
+		common.RecoverMiddleware,
+	)
+}
@@ -0,0 +1,8 @@
+package create
+
+import (
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+)
+
+var repo adapters.EntityRepository             // Set by GetLambdaHandler
+var idempotency adapters.IdempotencyRepository // Set by GetLambdaHandler
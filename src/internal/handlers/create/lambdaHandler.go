@@ -0,0 +1,74 @@
+package create
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/validation"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/chain"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Route in infra/lib/api.ts
+const Method = http.MethodPost
+const Resource = "/v1/entity"
+
+// Same rules as types.EntityUpdates but a name is required
+type BodyStructure struct {
+	Name string `json:"name" validate:"required,maxLength=256,pattern=^[^\\x00-\\x1f\\x7f]*$"`
+}
+
+const maxIdempotencyKeyLength = 255
+
+func lambdaAdapter(ctx context.Context, request types.Request) (types.Response, error) {
+	// requestContext := request.RequestContext
+	// authorizer := requestContext.Authorizer
+	// userId := authorizer["userId"].(string)
+	var body BodyStructure
+	decodeErr := validation.DecodeJson(request.Body, &body)
+	if decodeErr != nil {
+		return types.Response{}, decodeErr
+	}
+
+	idempotencyKey := common.GetHeader(request.Headers, "Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return types.Response{}, &types.InputError{
+			Err: errors.New("Idempotency-Key must be at most 255 characters."),
+		}
+	}
+
+	entityInfo, replayed, err := logic(ctx, repo, idempotency, body, common.PrincipalOf(request), idempotencyKey)
+	if err != nil {
+		return types.Response{}, err
+	}
+
+	headers := map[string]string{
+		"ETag": common.FormatEtag(entityInfo.Version),
+	}
+	if replayed {
+		headers["Idempotent-Replayed"] = "true"
+	}
+
+	jsonBody, marshalErr := json.Marshal(entityInfo)
+	if marshalErr != nil {
+		return types.Response{}, marshalErr
+	}
+
+	return types.Response{
+		StatusCode: 201,
+		Body:       string(jsonBody),
+		Headers:    headers,
+	}, err
+}
+
+func GetLambdaHandler() types.HandlerSignature {
+	repo = adapters.GetEntityRepository()
+	idempotency = adapters.GetIdempotencyRepository()
+	cors := common.DefaultCorsPolicy()
+	cors.ExposedHeaders = []string{"ETag", "Idempotent-Replayed"}
+	return chain.NewApiChain(cors).Then(lambdaAdapter)
+}
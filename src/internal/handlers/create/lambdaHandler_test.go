@@ -0,0 +1,74 @@
+package create
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func createRequest(authorizer map[string]interface{}, idempotencyKey string) types.Request {
+	return types.Request{
+		Method:     Method,
+		Resource:   Resource,
+		Headers:    map[string]string{"Idempotency-Key": idempotencyKey},
+		Body:       `{"name":"entity"}`,
+		Authorizer: authorizer,
+	}
+}
+
+func TestLambdaAdapterIdempotency(t *testing.T) {
+	first := map[string]interface{}{"principalId": "user-1"}
+
+	tests := []struct {
+		name         string
+		authorizer   map[string]interface{}
+		key          string
+		wantReplayed bool
+	}{
+		{name: "same principal and key", authorizer: first, key: "key-1", wantReplayed: true},
+		{name: "same principal, other key", authorizer: first, key: "key-2"},
+		{name: "other principal, same key", authorizer: map[string]interface{}{"principalId": "other"}, key: "key-1"},
+		{name: "no principal, same key", key: "key-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo = adapters.NewMemoryEntityRepository()
+			idempotency = adapters.NewMemoryIdempotencyRepository()
+
+			firstRes, firstErr := lambdaAdapter(context.Background(), createRequest(first, "key-1"))
+			if firstErr != nil {
+				t.Fatalf("unexpected error: %v", firstErr)
+			}
+
+			res, err := lambdaAdapter(context.Background(), createRequest(tt.authorizer, tt.key))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res.StatusCode != http.StatusCreated || res.Headers["ETag"] != `"1"` {
+				t.Errorf("got status %d and ETag %s, want 201 and \"1\"", res.StatusCode, res.Headers["ETag"])
+			}
+			if replayed := res.Headers["Idempotent-Replayed"] == "true"; replayed != tt.wantReplayed {
+				t.Errorf("got replayed %t, want %t", replayed, tt.wantReplayed)
+			}
+
+			firstEntity := types.Entity{}
+			json.Unmarshal([]byte(firstRes.Body), &firstEntity)
+			entity := types.Entity{}
+			if jsonErr := json.Unmarshal([]byte(res.Body), &entity); jsonErr != nil {
+				t.Fatalf("body is not JSON: %v", jsonErr)
+			}
+			if sameEntity := entity.Id == firstEntity.Id; sameEntity != tt.wantReplayed {
+				t.Errorf("got entity %s after %s, want the same one only on a replay", entity.Id, firstEntity.Id)
+			}
+			if entity.Version != 1 {
+				t.Errorf("got version %d, want 1", entity.Version)
+			}
+		})
+	}
+}
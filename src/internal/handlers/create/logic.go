@@ -0,0 +1,73 @@
+package create
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.uber.org/zap"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func createEntity(ctx context.Context, repo adapters.EntityRepository, name string) (*types.Entity, error) {
+	entityId := common.GenerateToken()
+	entity := types.Entity{
+		Id:   entityId,
+		Name: name,
+	}
+	return repo.CreateEntity(ctx, entity)
+}
+
+// Returns whether the entity came from an earlier request by principal with
+// the same idempotencyKey instead of being created now
+func logic(ctx context.Context, repo adapters.EntityRepository, idempotency adapters.IdempotencyRepository, body BodyStructure, principal string, idempotencyKey string) (*types.Entity, bool, error) {
+	if idempotencyKey == "" {
+		entity, err := createEntity(ctx, repo, body.Name)
+		return entity, false, err
+	}
+
+	storedResponse, startErr := idempotency.StartIdempotentRequest(ctx, principal, idempotencyKey, body)
+	if startErr != nil {
+		return &types.Entity{}, false, startErr
+	}
+
+	if storedResponse != nil {
+		entity := &types.Entity{}
+		unmarshalErr := json.Unmarshal([]byte(storedResponse.Body), entity)
+		if unmarshalErr != nil {
+			return &types.Entity{}, false, unmarshalErr
+		}
+		return entity, true, nil
+	}
+
+	entity, createErr := createEntity(ctx, repo, body.Name)
+	if createErr != nil {
+		releaseErr := idempotency.ReleaseIdempotentRequest(ctx, principal, idempotencyKey)
+		if releaseErr != nil {
+			common.LoggerFromContext(ctx).Error("Failed to release idempotency key",
+				zap.Error(releaseErr),
+			)
+		}
+		return entity, false, createErr
+	}
+
+	jsonBody, marshalErr := json.Marshal(entity)
+	if marshalErr != nil {
+		return entity, false, marshalErr
+	}
+
+	// The entity exists either way, so a failure here only costs the replay
+	completeErr := idempotency.CompleteIdempotentRequest(ctx, principal, idempotencyKey, types.IdempotentResponse{
+		StatusCode: 201,
+		Body:       string(jsonBody),
+	})
+	if completeErr != nil {
+		common.LoggerFromContext(ctx).Error("Failed to store idempotent response",
+			zap.Error(completeErr),
+		)
+	}
+
+	return entity, false, nil
+}
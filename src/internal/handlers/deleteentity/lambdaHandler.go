@@ -0,0 +1,42 @@
+package deleteentity
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/chain"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Route in infra/lib/api.ts
+const Method = http.MethodDelete
+const Resource = "/v1/entity/{entityId}"
+
+type ResponseStructure struct {
+	Id string `json:"id"`
+}
+
+func lambdaAdapter(ctx context.Context, request types.Request) (types.Response, error) {
+	entityId := request.PathParameters["entityId"]
+
+	expectedVersion, ifMatchErr := common.ParseIfMatch(common.GetHeader(request.Headers, "If-Match"))
+	if ifMatchErr != nil {
+		return types.Response{}, ifMatchErr
+	}
+
+	err := logic(ctx, repo, entityId, expectedVersion)
+	if err != nil {
+		return types.Response{}, err
+	}
+
+	return types.Response{
+		StatusCode: 204,
+	}, err
+}
+
+func GetLambdaHandler() types.HandlerSignature {
+	repo = adapters.GetEntityRepository()
+	return chain.NewApiChain(common.DefaultCorsPolicy()).Then(lambdaAdapter)
+}
@@ -0,0 +1,10 @@
+package deleteentity
+
+import (
+	"context"
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+)
+
+func logic(ctx context.Context, repo adapters.EntityRepository, entityId string, expectedVersion int) error {
+	return repo.DeleteEntity(ctx, entityId, expectedVersion, true)
+}
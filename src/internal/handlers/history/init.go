@@ -0,0 +1,13 @@
+package history
+
+import (
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	configMod "github.com/thomasstep/giphy-livechat-api/internal/common/config"
+)
+
+var config *configMod.ConfigStruct
+var repo adapters.EntityRepository // Set by GetLambdaHandler
+
+func init() {
+	config = configMod.GetConfig()
+}
@@ -0,0 +1,46 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/chain"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Route in infra/lib/api.ts
+const Method = http.MethodGet
+const Resource = "/v1/entity/{entityId}/history"
+
+func lambdaAdapter(ctx context.Context, request types.Request) (types.Response, error) {
+	limit, limitErr := common.ParseLimit(request.QueryStringParameters["limit"], config.Limit)
+	if limitErr != nil {
+		return types.Response{}, limitErr
+	}
+	nextToken := request.QueryStringParameters["nextToken"]
+	entityId := request.PathParameters["entityId"]
+
+	historyList, err := logic(ctx, repo, entityId, limit, nextToken)
+	if err != nil {
+		return types.Response{}, err
+	}
+
+	jsonBody, marshalErr := json.Marshal(historyList)
+	if marshalErr != nil {
+		return types.Response{}, marshalErr
+	}
+
+	return types.Response{
+		StatusCode: 200,
+		Body:       string(jsonBody),
+	}, err
+}
+
+func GetLambdaHandler() types.HandlerSignature {
+	adapters.RequirePaginationTokenKey()
+	repo = adapters.GetEntityRepository()
+	return chain.NewApiChain(common.DefaultCorsPolicy()).Then(lambdaAdapter)
+}
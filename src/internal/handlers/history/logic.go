@@ -0,0 +1,24 @@
+package history
+
+import (
+	"context"
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// History outlives hard deletes, so a missing entity is not an error
+func logic(ctx context.Context, repo adapters.EntityRepository, entityId string, limit int, nextToken string) (*types.EntityHistoryList, error) {
+	history, lastToken, err := repo.QueryEntityHistory(ctx, entityId, limit, nextToken)
+	if err != nil {
+		return &types.EntityHistoryList{}, err
+	}
+
+	historyList := &types.EntityHistoryList{
+		History: history,
+	}
+	if lastToken != "" {
+		historyList.Pagination.NextToken = &lastToken
+	}
+
+	return historyList, nil
+}
@@ -0,0 +1,69 @@
+package lambdaAuthorizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// Wrapped by every error that means tokens could not be checked at all, as
+// opposed to a token being rejected
+var ErrJwksUnavailable = errors.New("JWKS is unavailable")
+
+var errUnknownKid = errors.New("token was signed with an unknown key")
+
+// keySetCache holds the JWKS for the lifetime of the container. It is only
+// fetched again when a token names a key it does not know, which is how
+// signing key rotations show up.
+type keySetCache struct {
+	url                string
+	client             *http.Client
+	minRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	keySet      jwk.Set
+	refreshedAt time.Time
+}
+
+func newKeySetCache(url string, client *http.Client, minRefreshInterval time.Duration) *keySetCache {
+	return &keySetCache{
+		url:                url,
+		client:             client,
+		minRefreshInterval: minRefreshInterval,
+	}
+}
+
+func (c *keySetCache) lookupKey(ctx context.Context, kid string) (jwk.Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.keySet != nil {
+		if key, found := c.keySet.LookupKeyID(kid); found {
+			return key, nil
+		}
+		// Otherwise anyone could make us fetch the JWKS by sending made up
+		// key IDs
+		if time.Since(c.refreshedAt) < c.minRefreshInterval {
+			return nil, errUnknownKid
+		}
+	}
+
+	c.refreshedAt = time.Now()
+	keySet, fetchErr := jwk.Fetch(ctx, c.url, jwk.WithHTTPClient(c.client))
+	if fetchErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJwksUnavailable, fetchErr)
+	}
+	c.keySet = keySet
+
+	key, found := keySet.LookupKeyID(kid)
+	if !found {
+		return nil, errUnknownKid
+	}
+
+	return key, nil
+}
@@ -0,0 +1,119 @@
+package lambdaAuthorizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/tracing"
+)
+
+// Helper function to generate an IAM policy
+func generatePolicy(principalId string, effect string, resource string) events.APIGatewayCustomAuthorizerResponse {
+	authResponse := events.APIGatewayCustomAuthorizerResponse{PrincipalID: principalId}
+
+	if effect != "" && resource != "" {
+		authResponse.PolicyDocument = events.APIGatewayCustomAuthorizerPolicy{
+			Version: "2012-10-17",
+			Statement: []events.IAMPolicyStatement{
+				{
+					Action:   []string{"execute-api:Invoke"},
+					Effect:   effect,
+					Resource: []string{resource},
+				},
+			},
+		}
+	}
+
+	// Optional output with custom properties of the String, Number or Boolean type.
+	// Add userId string to function parameters
+	// authResponse.Context = map[string]interface{}{
+	// 	"userId": userId,
+	// }
+	return authResponse
+}
+
+func HandleRequest(ctx context.Context, event events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	defer tracing.Flush(ctx)
+	ctx, span := tracing.StartInvocation(ctx, "lambdaAuthorizer", trace.SpanKindServer, tracing.HeaderCarrier(event.Headers),
+		trace.WithAttributes(
+			semconv.FaaSTriggerHTTP,
+			semconv.HTTPRequestMethodKey.String(event.HTTPMethod),
+			semconv.HTTPRoute(event.Resource),
+		),
+	)
+	defer span.End()
+
+	ctx, logger := common.InvocationLogger(ctx,
+		zap.String("requestId", event.RequestContext.RequestID),
+		zap.String("route", fmt.Sprintf("%s %s", event.HTTPMethod, event.Resource)),
+	)
+	defer common.FlushLogger(logger)
+
+	// Get resource before determining if user is allowed or not
+	// first two pieces are apiGatewayArn and stage
+	methodArnPieces := strings.Split(event.MethodArn, "/")
+	// without doing this, the user only gains access to the single resource and
+	// method. access to the rest of the api will be denied
+	var apiStageArn string
+	if len(methodArnPieces) >= 2 {
+		apiStageArn = fmt.Sprintf("%s/%s/*", methodArnPieces[0], methodArnPieces[1])
+	} else {
+		logger.Error(
+			"Could not parse method ARN",
+			zap.String("methodArn", event.MethodArn),
+		)
+		return events.APIGatewayCustomAuthorizerResponse{}, errors.New("Error: Could not parse method ARN")
+	}
+
+	capHeader := event.Headers["Authorization"]
+	lowerHeader := event.Headers["authorization"]
+	header := capHeader
+	if capHeader == "" {
+		header = lowerHeader
+	}
+	headerPieces := strings.Split(header, " ")
+	var token string
+	if len(headerPieces) == 2 && strings.EqualFold(headerPieces[0], "Bearer") {
+		token = headerPieces[1]
+	}
+
+	if token == "" {
+		headerNames := make([]string, 0, len(event.Headers))
+		for name := range event.Headers {
+			headerNames = append(headerNames, name)
+		}
+		logger.Error(
+			"Could not get token from headers",
+			zap.Strings("headerNames", headerNames),
+		)
+		return generatePolicy("user", "Deny", apiStageArn), nil
+	}
+
+	principalId, verifyErr := GetTokenVerifier().Verify(ctx, token)
+	if errors.Is(verifyErr, ErrJwksUnavailable) {
+		// API Gateway answers with a 500 instead of denying valid tokens
+		logger.Error(
+			"Could not verify token",
+			zap.Error(verifyErr),
+		)
+		tracing.RecordError(span, verifyErr)
+		return events.APIGatewayCustomAuthorizerResponse{}, errors.New("Error: Could not get JWKS")
+	}
+	if verifyErr != nil {
+		logger.Warn(
+			"Rejected token",
+			zap.Error(verifyErr),
+		)
+		return generatePolicy("user", "Deny", apiStageArn), nil
+	}
+
+	return generatePolicy(principalId, "Allow", apiStageArn), nil
+}
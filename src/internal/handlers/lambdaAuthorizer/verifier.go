@@ -0,0 +1,146 @@
+package lambdaAuthorizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// Upper bound for fetching the JWKS, on top of the invocation's deadline
+const jwksFetchTimeout = 3 * time.Second
+
+// TokenVerifier checks a bearer token and returns the principal it was
+// issued to. Errors wrapping ErrJwksUnavailable mean the token could not be
+// checked, any other error means it was rejected.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (string, error)
+}
+
+type JwtVerifierOptions struct {
+	JwksUrl string
+	// iss and aud are only checked when these are set
+	Issuer   string
+	Audience string
+	// e.g. RS256 or ES256
+	Algorithms         []string
+	ClockSkew          time.Duration
+	MinRefreshInterval time.Duration
+	// Uses a client with jwksFetchTimeout when nil
+	HTTPClient *http.Client
+}
+
+// JwtVerifier accepts signed JWTs whose kid is in the JWKS at JwksUrl and
+// which carry exp and sub claims
+type JwtVerifier struct {
+	options    JwtVerifierOptions
+	algorithms map[string]bool
+	keys       *keySetCache
+}
+
+func NewJwtVerifier(options JwtVerifierOptions) *JwtVerifier {
+	algorithms := map[string]bool{}
+	for _, algorithm := range options.Algorithms {
+		algorithm = strings.TrimSpace(algorithm)
+		// Unsigned tokens are never acceptable
+		if algorithm != "" && !strings.EqualFold(algorithm, "none") {
+			algorithms[algorithm] = true
+		}
+	}
+
+	client := options.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: jwksFetchTimeout}
+	}
+
+	return &JwtVerifier{
+		options:    options,
+		algorithms: algorithms,
+		keys:       newKeySetCache(options.JwksUrl, client, options.MinRefreshInterval),
+	}
+}
+
+func (v *JwtVerifier) Verify(ctx context.Context, token string) (string, error) {
+	if v.options.JwksUrl == "" {
+		return "", fmt.Errorf("%w: JWKS URL is not configured", ErrJwksUnavailable)
+	}
+
+	message, parseErr := jws.ParseString(token)
+	if parseErr != nil {
+		return "", parseErr
+	}
+	if len(message.Signatures()) != 1 {
+		return "", errors.New("token must have exactly one signature")
+	}
+
+	headers := message.Signatures()[0].ProtectedHeaders()
+	algorithm := headers.Algorithm()
+	if !v.algorithms[algorithm.String()] {
+		return "", fmt.Errorf("algorithm %q is not allowed", algorithm)
+	}
+	if headers.KeyID() == "" {
+		return "", errors.New("token does not name its key")
+	}
+
+	key, keyErr := v.keys.lookupKey(ctx, headers.KeyID())
+	if keyErr != nil {
+		return "", keyErr
+	}
+	// Keys that name an algorithm may only be used with that one
+	if keyAlgorithm := key.Algorithm().String(); keyAlgorithm != "" && keyAlgorithm != algorithm.String() {
+		return "", fmt.Errorf("key %q is not for algorithm %q", headers.KeyID(), algorithm)
+	}
+
+	parseOptions := []jwt.ParseOption{
+		jwt.WithKey(algorithm, key),
+		jwt.WithValidate(true),
+		jwt.WithAcceptableSkew(v.options.ClockSkew),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithRequiredClaim(jwt.SubjectKey),
+	}
+	if v.options.Issuer != "" {
+		parseOptions = append(parseOptions, jwt.WithIssuer(v.options.Issuer))
+	}
+	if v.options.Audience != "" {
+		parseOptions = append(parseOptions, jwt.WithAudience(v.options.Audience))
+	}
+
+	verifiedToken, verifyErr := jwt.ParseString(token, parseOptions...)
+	if verifyErr != nil {
+		return "", verifyErr
+	}
+
+	return verifiedToken.Subject(), nil
+}
+
+var tokenVerifier TokenVerifier
+var onceTokenVerifier sync.Once
+
+func GetTokenVerifier() TokenVerifier {
+	onceTokenVerifier.Do(func() {
+		tokenVerifier = NewJwtVerifier(JwtVerifierOptions{
+			JwksUrl:            config.JwksUrl,
+			Issuer:             config.JwtIssuer,
+			Audience:           config.JwtAudience,
+			Algorithms:         config.JwtAlgorithms,
+			ClockSkew:          config.JwtClockSkew,
+			MinRefreshInterval: config.JwksMinRefreshInterval,
+		})
+	})
+
+	return tokenVerifier
+}
+
+// Replaces the verifier GetTokenVerifier hands out. Only takes effect before
+// the first call to GetTokenVerifier.
+func SetTokenVerifier(verifier TokenVerifier) {
+	onceTokenVerifier.Do(func() {
+		tokenVerifier = verifier
+	})
+}
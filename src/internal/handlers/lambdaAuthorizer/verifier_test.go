@@ -0,0 +1,281 @@
+package lambdaAuthorizer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "test-api"
+)
+
+// Serves the public half of its keys as a JWKS and counts the fetches
+type testJwks struct {
+	server  *httptest.Server
+	keys    map[string]jwk.Key
+	fetches atomic.Int32
+	failing atomic.Bool
+}
+
+func newTestJwks(t *testing.T, kids ...string) *testJwks {
+	t.Helper()
+
+	jwks := &testJwks{keys: map[string]jwk.Key{}}
+	publicSet := jwk.NewSet()
+	for _, kid := range kids {
+		rawKey, generateErr := rsa.GenerateKey(rand.Reader, 2048)
+		if generateErr != nil {
+			t.Fatal(generateErr)
+		}
+		privateKey, keyErr := jwk.FromRaw(rawKey)
+		if keyErr != nil {
+			t.Fatal(keyErr)
+		}
+		privateKey.Set(jwk.KeyIDKey, kid)
+		privateKey.Set(jwk.AlgorithmKey, jwa.RS256)
+		jwks.keys[kid] = privateKey
+
+		publicKey, publicErr := privateKey.PublicKey()
+		if publicErr != nil {
+			t.Fatal(publicErr)
+		}
+		publicSet.AddKey(publicKey)
+	}
+
+	jwks.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwks.fetches.Add(1)
+		if jwks.failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(publicSet)
+	}))
+	t.Cleanup(jwks.server.Close)
+
+	return jwks
+}
+
+func (j *testJwks) verifier(minRefreshInterval time.Duration) *JwtVerifier {
+	return NewJwtVerifier(JwtVerifierOptions{
+		JwksUrl:            j.server.URL,
+		Issuer:             testIssuer,
+		Audience:           testAudience,
+		Algorithms:         []string{"RS256"},
+		MinRefreshInterval: minRefreshInterval,
+	})
+}
+
+type testClaims struct {
+	issuer   string
+	audience string
+	subject  string
+	expires  time.Time
+}
+
+func validClaims() testClaims {
+	return testClaims{
+		issuer:   testIssuer,
+		audience: testAudience,
+		subject:  "user-1",
+		expires:  time.Now().Add(time.Hour),
+	}
+}
+
+func (c testClaims) token(t *testing.T) jwt.Token {
+	t.Helper()
+
+	builder := jwt.NewBuilder().
+		Issuer(c.issuer).
+		Audience([]string{c.audience}).
+		Expiration(c.expires)
+	if c.subject != "" {
+		builder = builder.Subject(c.subject)
+	}
+	token, buildErr := builder.Build()
+	if buildErr != nil {
+		t.Fatal(buildErr)
+	}
+
+	return token
+}
+
+func (j *testJwks) sign(t *testing.T, kid string, claims testClaims) string {
+	t.Helper()
+
+	signed, signErr := jwt.Sign(claims.token(t), jwt.WithKey(jwa.RS256, j.keys[kid]))
+	if signErr != nil {
+		t.Fatal(signErr)
+	}
+
+	return string(signed)
+}
+
+// Unsigned token that otherwise looks like one of ours
+func unsignedToken(t *testing.T, kid string) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "none", "kid": kid, "typ": "JWT"})
+	payload, payloadErr := json.Marshal(validClaims().token(t))
+	if payloadErr != nil {
+		t.Fatal(payloadErr)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestJwtVerifierVerify(t *testing.T) {
+	jwks := newTestJwks(t, "key-1")
+	other := newTestJwks(t, "key-1", "key-2")
+
+	tests := []struct {
+		name        string
+		token       func(t *testing.T) string
+		wantSubject string
+	}{
+		{
+			name: "valid token",
+			token: func(t *testing.T) string {
+				return jwks.sign(t, "key-1", validClaims())
+			},
+			wantSubject: "user-1",
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return unsignedToken(t, "key-1")
+			},
+		},
+		{
+			name: "unknown kid",
+			token: func(t *testing.T) string {
+				return other.sign(t, "key-2", validClaims())
+			},
+		},
+		{
+			name: "signed by a different key with a known kid",
+			token: func(t *testing.T) string {
+				return other.sign(t, "key-1", validClaims())
+			},
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.expires = time.Now().Add(-time.Minute)
+				return jwks.sign(t, "key-1", claims)
+			},
+		},
+		{
+			name: "wrong issuer",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.issuer = "https://other.example.com"
+				return jwks.sign(t, "key-1", claims)
+			},
+		},
+		{
+			name: "wrong audience",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.audience = "other-api"
+				return jwks.sign(t, "key-1", claims)
+			},
+		},
+		{
+			name: "missing subject",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.subject = ""
+				return jwks.sign(t, "key-1", claims)
+			},
+		},
+		{
+			name: "not a jwt",
+			token: func(t *testing.T) string {
+				return "not-a-jwt"
+			},
+		},
+	}
+
+	verifier := jwks.verifier(time.Minute)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, verifyErr := verifier.Verify(context.Background(), tt.token(t))
+			if tt.wantSubject == "" {
+				if verifyErr == nil {
+					t.Fatalf("token was accepted for %q", subject)
+				}
+				if errors.Is(verifyErr, ErrJwksUnavailable) {
+					t.Fatalf("token was not checked: %v", verifyErr)
+				}
+				return
+			}
+
+			if verifyErr != nil {
+				t.Fatalf("unexpected error: %v", verifyErr)
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("got subject %q, want %q", subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestJwtVerifierRefresh(t *testing.T) {
+	tests := []struct {
+		name               string
+		minRefreshInterval time.Duration
+		// Fetches after a valid token and two tokens with an unknown kid
+		wantFetches int32
+	}{
+		{name: "within the refresh interval", minRefreshInterval: time.Hour, wantFetches: 1},
+		{name: "without a refresh interval", minRefreshInterval: 0, wantFetches: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwks := newTestJwks(t, "key-1")
+			other := newTestJwks(t, "key-2")
+			verifier := jwks.verifier(tt.minRefreshInterval)
+
+			_, verifyErr := verifier.Verify(context.Background(), jwks.sign(t, "key-1", validClaims()))
+			if verifyErr != nil {
+				t.Fatalf("unexpected error: %v", verifyErr)
+			}
+			for i := 0; i < 2; i++ {
+				_, verifyErr = verifier.Verify(context.Background(), other.sign(t, "key-2", validClaims()))
+				if !errors.Is(verifyErr, errUnknownKid) {
+					t.Fatalf("got error %v, want %v", verifyErr, errUnknownKid)
+				}
+			}
+
+			if fetches := jwks.fetches.Load(); fetches != tt.wantFetches {
+				t.Errorf("JWKS was fetched %d times, want %d", fetches, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestJwtVerifierJwksUnavailable(t *testing.T) {
+	jwks := newTestJwks(t, "key-1")
+	jwks.failing.Store(true)
+
+	_, verifyErr := jwks.verifier(time.Minute).Verify(context.Background(), jwks.sign(t, "key-1", validClaims()))
+	if !errors.Is(verifyErr, ErrJwksUnavailable) {
+		t.Fatalf("got error %v, want %v", verifyErr, ErrJwksUnavailable)
+	}
+}
@@ -0,0 +1,23 @@
+package list
+
+import (
+	"context"
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func logic(ctx context.Context, repo adapters.EntityRepository, limit int, nextToken string) (*types.EntityList, error) {
+	entities, lastToken, err := repo.ListEntities(ctx, limit, nextToken)
+	if err != nil {
+		return &types.EntityList{}, err
+	}
+
+	entityList := &types.EntityList{
+		Entities: entities,
+	}
+	if lastToken != "" {
+		entityList.Pagination.NextToken = &lastToken
+	}
+
+	return entityList, nil
+}
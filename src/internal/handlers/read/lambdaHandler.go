@@ -0,0 +1,73 @@
+package read
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/chain"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Route in infra/lib/api.ts
+const Method = http.MethodGet
+const Resource = "/v1/entity/{entityId}"
+
+func lambdaAdapter(ctx context.Context, request types.Request) (types.Response, error) {
+	entityId := request.PathParameters["entityId"]
+
+	entity, err := logic(ctx, repo, entityId)
+	if err != nil {
+		return types.Response{}, err
+	}
+
+	// Versions change on every write, so they make strong ETags
+	etag := common.FormatEtag(entity.Version)
+	headers := map[string]string{
+		"ETag":          etag,
+		"Cache-Control": config.ReadCacheControl,
+	}
+
+	lastModified, timeErr := time.Parse(time.RFC3339, entity.UpdatedTime)
+	if timeErr == nil {
+		headers["Last-Modified"] = lastModified.UTC().Format(http.TimeFormat)
+	}
+
+	// If-Modified-Since is ignored when If-None-Match is sent
+	ifNoneMatch := common.GetHeader(request.Headers, "If-None-Match")
+	ifModifiedSince := common.GetHeader(request.Headers, "If-Modified-Since")
+	notModified := false
+	if ifNoneMatch != "" {
+		notModified = common.MatchesIfNoneMatch(ifNoneMatch, etag)
+	} else if ifModifiedSince != "" && timeErr == nil {
+		notModified = common.NotModifiedSince(ifModifiedSince, lastModified)
+	}
+
+	if notModified {
+		return types.Response{
+			StatusCode: http.StatusNotModified,
+			Headers:    headers,
+		}, nil
+	}
+
+	jsonBody, marshalErr := json.Marshal(entity)
+	if marshalErr != nil {
+		return types.Response{}, marshalErr
+	}
+
+	return types.Response{
+		StatusCode: 200,
+		Body:       string(jsonBody),
+		Headers:    headers,
+	}, err
+}
+
+func GetLambdaHandler() types.HandlerSignature {
+	repo = adapters.GetEntityRepository()
+	cors := common.DefaultCorsPolicy()
+	cors.ExposedHeaders = []string{"ETag", "Last-Modified"}
+	return chain.NewApiChain(cors).Then(lambdaAdapter)
+}
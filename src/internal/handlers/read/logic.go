@@ -1,14 +1,15 @@
-package main
+package read
 
 import (
+	"context"
 	"errors"
 
 	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
 	"github.com/thomasstep/giphy-livechat-api/internal/types"
 )
 
-func logic(entityId string) (*types.Entity, error) {
-	entity, err := adapters.ReadEntity(entityId)
+func logic(ctx context.Context, repo adapters.EntityRepository, entityId string) (*types.Entity, error) {
+	entity, err := repo.ReadEntity(ctx, entityId)
 	if err != nil {
 		return &types.Entity{}, err
 	}
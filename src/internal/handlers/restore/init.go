@@ -0,0 +1,7 @@
+package restore
+
+import (
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+)
+
+var repo adapters.EntityRepository // Set by GetLambdaHandler
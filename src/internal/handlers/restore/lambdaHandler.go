@@ -0,0 +1,45 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/chain"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Route in infra/lib/api.ts
+const Method = http.MethodPost
+const Resource = "/v1/entity/{entityId}/restore"
+
+func lambdaAdapter(ctx context.Context, request types.Request) (types.Response, error) {
+	entityId := request.PathParameters["entityId"]
+
+	entity, err := logic(ctx, repo, entityId)
+	if err != nil {
+		return types.Response{}, err
+	}
+
+	jsonBody, marshalErr := json.Marshal(entity)
+	if marshalErr != nil {
+		return types.Response{}, marshalErr
+	}
+
+	return types.Response{
+		StatusCode: 200,
+		Body:       string(jsonBody),
+		Headers: map[string]string{
+			"ETag": common.FormatEtag(entity.Version),
+		},
+	}, err
+}
+
+func GetLambdaHandler() types.HandlerSignature {
+	repo = adapters.GetEntityRepository()
+	cors := common.DefaultCorsPolicy()
+	cors.ExposedHeaders = []string{"ETag"}
+	return chain.NewApiChain(cors).Then(lambdaAdapter)
+}
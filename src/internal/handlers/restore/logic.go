@@ -0,0 +1,16 @@
+package restore
+
+import (
+	"context"
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func logic(ctx context.Context, repo adapters.EntityRepository, entityId string) (*types.Entity, error) {
+	restoredEntity, err := repo.RestoreEntity(ctx, entityId)
+	if err != nil {
+		return &types.Entity{}, err
+	}
+
+	return restoredEntity, nil
+}
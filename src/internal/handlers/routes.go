@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/create"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/deleteentity"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/history"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/list"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/read"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/restore"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/update"
+)
+
+// Every API route, for binaries that serve more than one of them. Repository
+// overrides have to be in place before this is called.
+func GetRoutes() []common.Route {
+	return []common.Route{
+		{Method: create.Method, Resource: create.Resource, Handler: create.GetLambdaHandler()},
+		{Method: list.Method, Resource: list.Resource, Handler: list.GetLambdaHandler()},
+		{Method: read.Method, Resource: read.Resource, Handler: read.GetLambdaHandler()},
+		{Method: update.Method, Resource: update.Resource, Handler: update.GetLambdaHandler()},
+		{Method: deleteentity.Method, Resource: deleteentity.Resource, Handler: deleteentity.GetLambdaHandler()},
+		{Method: restore.Method, Resource: restore.Resource, Handler: restore.GetLambdaHandler()},
+		{Method: history.Method, Resource: history.Resource, Handler: history.GetLambdaHandler()},
+	}
+}
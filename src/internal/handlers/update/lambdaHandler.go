@@ -0,0 +1,64 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/common"
+	"github.com/thomasstep/giphy-livechat-api/internal/common/validation"
+	"github.com/thomasstep/giphy-livechat-api/internal/handlers/chain"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+// Route in infra/lib/api.ts
+const Method = http.MethodPut
+const Resource = "/v1/entity/{entityId}"
+
+type ResponseStructure struct {
+	Id string `json:"id"`
+}
+
+func lambdaAdapter(ctx context.Context, request types.Request) (types.Response, error) {
+	entityId := request.PathParameters["entityId"]
+	var body types.EntityUpdates
+	decodeErr := validation.DecodeJson(request.Body, &body)
+	if decodeErr != nil {
+		return types.Response{}, decodeErr
+	}
+
+	expectedVersion, ifMatchErr := common.ParseIfMatch(common.GetHeader(request.Headers, "If-Match"))
+	if ifMatchErr != nil {
+		return types.Response{}, ifMatchErr
+	}
+
+	entity, err := logic(ctx, repo, entityId, body, expectedVersion)
+	if err != nil {
+		return types.Response{}, err
+	}
+
+	jsonBody, marshalErr := json.Marshal(entity)
+	if marshalErr != nil {
+		return types.Response{}, marshalErr
+	}
+
+	headers := map[string]string{}
+	// Nothing is written when there are no updates
+	if entity.Version > 0 {
+		headers["ETag"] = common.FormatEtag(entity.Version)
+	}
+
+	return types.Response{
+		StatusCode: 200,
+		Body:       string(jsonBody),
+		Headers:    headers,
+	}, err
+}
+
+func GetLambdaHandler() types.HandlerSignature {
+	repo = adapters.GetEntityRepository()
+	cors := common.DefaultCorsPolicy()
+	cors.ExposedHeaders = []string{"ETag"}
+	return chain.NewApiChain(cors).Then(lambdaAdapter)
+}
@@ -0,0 +1,16 @@
+package update
+
+import (
+	"context"
+	"github.com/thomasstep/giphy-livechat-api/internal/adapters"
+	"github.com/thomasstep/giphy-livechat-api/internal/types"
+)
+
+func logic(ctx context.Context, repo adapters.EntityRepository, entityId string, updates types.EntityUpdates, expectedVersion int) (*types.Entity, error) {
+	updatedEntity, err := repo.UpdateEntity(ctx, entityId, updates, expectedVersion, false)
+	if err != nil {
+		return &types.Entity{}, err
+	}
+
+	return updatedEntity, nil
+}
@@ -1,17 +1,31 @@
 package types
 
 type Entity struct {
-	Id        string `json:"id" dynamodbav:"-"`
-	Name      string `json:"name,omitempty" dynamodbav:"name"` // Optional
+	Id      string `json:"id" dynamodbav:"-"`
+	Name    string `json:"name,omitempty" dynamodbav:"name"` // Optional
+	Version int    `json:"version" dynamodbav:"-"`           // Copied from DdbEntityItem
+	// Copied from DdbEntityItem, only used for Last-Modified
+	UpdatedTime string `json:"-" dynamodbav:"-"`
 }
 
+// Values for expectedVersion on writes. Anything else, including the 0 of
+// items written before versioning, has to match the stored version for the
+// write to go through.
+const (
+	// No If-Match header
+	UnconditionalVersion = -2
+	// If-Match: *
+	AnyVersion = -1
+)
+
 type EntityList struct {
-	Entities      []Entity     `json:"entity"`
+	Entities   []Entity   `json:"entity"`
 	Pagination Pagination `json:"pagination"`
 }
 
+// Names are limited to 256 characters without control characters
 type EntityUpdates struct {
-	Name string `json:"name" dynamodbav:"name"`
+	Name string `json:"name" dynamodbav:"name" validate:"maxLength=256,pattern=^[^\\x00-\\x1f\\x7f]*$"`
 }
 
 type DdbEntityItem struct {
@@ -20,6 +34,37 @@ type DdbEntityItem struct {
 	SecondaryId string `dynamodbav:"secondaryId"`
 	CreatedTime string `json:"createdTime" dynamodbav:"createdTime"`
 	UpdatedTime string `json:"updatedTime" dynamodbav:"updatedTime"`
+	Version     int    `json:"version" dynamodbav:"version"` // Incremented on every write
+	// Only set on soft-deleted entities
+	DeletedTime string `json:"deletedTime,omitempty" dynamodbav:"deletedTime,omitempty"`
+	Ttl         int64  `json:"-" dynamodbav:"ttl,omitempty"`
+}
+
+// Operations recorded in an entity's history
+const (
+	EntityCreated  = "created"
+	EntityUpdated  = "updated"
+	EntityDeleted  = "deleted"
+	EntityRestored = "restored"
+)
+
+// Immutable snapshot of an entity right after a change
+type EntityHistory struct {
+	Operation string `json:"operation" dynamodbav:"operation"`
+	Version   int    `json:"version" dynamodbav:"version"`
+	Time      string `json:"time" dynamodbav:"time"`
+	Entity    Entity `json:"entity" dynamodbav:"entity"`
+}
+
+type EntityHistoryList struct {
+	History    []EntityHistory `json:"history"`
+	Pagination Pagination      `json:"pagination"`
+}
+
+type DdbEntityHistoryItem struct {
+	EntityHistory
+	Id          string `dynamodbav:"id"`
+	SecondaryId string `dynamodbav:"secondaryId"`
 }
 
 type Pagination struct {
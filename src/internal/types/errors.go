@@ -1,9 +1,56 @@
 package types
 
+// Body API Gateway itself uses for errors, e.g. a failed authorizer
 type ErrorResponseStructure struct {
 	Message string `json:"message"`
 }
 
+// RFC 7807 body sent as application/problem+json for every handled error
+type ProblemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance,omitempty"`
+	// Stable and machine-readable, unlike title and detail
+	Code       string           `json:"code"`
+	Violations []FieldViolation `json:"violations,omitempty"`
+	// Lambda's ID for the invocation, to find its logs
+	RequestId string `json:"requestId,omitempty"`
+}
+
+// One reason a request field was rejected
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Implemented by every error that is sent to clients. Errors that do not
+// implement it fail the invocation.
+type ProblemError interface {
+	error
+	Status() int
+	Code() string
+	Title() string
+}
+
+// Stable codes clients can rely on
+const (
+	ExistingUserCode        = "EXISTING_USER"
+	InvalidInputCode        = "INVALID_INPUT"
+	NotFoundCode            = "NOT_FOUND"
+	MissingUserIdCode       = "MISSING_USER_ID"
+	UnauthorizedCode        = "UNAUTHORIZED"
+	ConflictCode            = "CONFLICT"
+	PreconditionFailedCode  = "PRECONDITION_FAILED"
+	InternalErrorCode       = "INTERNAL_ERROR"
+	ServiceUnavailableCode  = "SERVICE_UNAVAILABLE"
+	GatewayTimeoutCode      = "GATEWAY_TIMEOUT"
+	UnprocessableEntityCode = "UNPROCESSABLE_ENTITY"
+	MethodNotAllowedCode    = "METHOD_NOT_ALLOWED"
+)
+
 type ExistingUsersError struct {
 	Err error
 }
@@ -12,14 +59,25 @@ func (r *ExistingUsersError) Error() string {
 	return r.Err.Error()
 }
 
+func (r *ExistingUsersError) Unwrap() error { return r.Err }
+func (r *ExistingUsersError) Status() int   { return 409 }
+func (r *ExistingUsersError) Code() string  { return ExistingUserCode }
+func (r *ExistingUsersError) Title() string { return "User already exists" }
+
 type InputError struct {
-	Err error
+	Err        error
+	Violations []FieldViolation
 }
 
 func (r *InputError) Error() string {
 	return r.Err.Error()
 }
 
+func (r *InputError) Unwrap() error { return r.Err }
+func (r *InputError) Status() int   { return 400 }
+func (r *InputError) Code() string  { return InvalidInputCode }
+func (r *InputError) Title() string { return "Invalid input" }
+
 type MissingResourceError struct {
 	Err error
 }
@@ -28,6 +86,11 @@ func (r *MissingResourceError) Error() string {
 	return r.Err.Error()
 }
 
+func (r *MissingResourceError) Unwrap() error { return r.Err }
+func (r *MissingResourceError) Status() int   { return 404 }
+func (r *MissingResourceError) Code() string  { return NotFoundCode }
+func (r *MissingResourceError) Title() string { return "Resource not found" }
+
 type MissingUserIdError struct {
 	Err error
 }
@@ -36,6 +99,11 @@ func (r *MissingUserIdError) Error() string {
 	return r.Err.Error()
 }
 
+func (r *MissingUserIdError) Unwrap() error { return r.Err }
+func (r *MissingUserIdError) Status() int   { return 401 }
+func (r *MissingUserIdError) Code() string  { return MissingUserIdCode }
+func (r *MissingUserIdError) Title() string { return "Missing user ID" }
+
 type UnauthorizedError struct {
 	Err error
 }
@@ -44,16 +112,121 @@ func (r *UnauthorizedError) Error() string {
 	return r.Err.Error()
 }
 
+func (r *UnauthorizedError) Unwrap() error { return r.Err }
+func (r *UnauthorizedError) Status() int   { return 401 }
+func (r *UnauthorizedError) Code() string  { return UnauthorizedCode }
+func (r *UnauthorizedError) Title() string { return "Unauthorized" }
+
+// Cause, when set, is the underlying error and only kept for logging
 type ConflictError struct {
-	Err error
+	Err   error
+	Cause error
 }
 
 func (r *ConflictError) Error() string {
 	return r.Err.Error()
 }
 
-type InternalError struct{}
+func (r *ConflictError) Unwrap() error {
+	if r.Cause != nil {
+		return r.Cause
+	}
+	return r.Err
+}
+
+func (r *ConflictError) Status() int   { return 409 }
+func (r *ConflictError) Code() string  { return ConflictCode }
+func (r *ConflictError) Title() string { return "Conflict" }
+
+type PreconditionFailedError struct {
+	Err error
+}
+
+func (r *PreconditionFailedError) Error() string {
+	return r.Err.Error()
+}
+
+func (r *PreconditionFailedError) Unwrap() error { return r.Err }
+func (r *PreconditionFailedError) Status() int   { return 412 }
+func (r *PreconditionFailedError) Code() string  { return PreconditionFailedCode }
+func (r *PreconditionFailedError) Title() string { return "Precondition failed" }
+
+// Err is only kept for logging, clients always get the generic message
+type InternalError struct {
+	Err error
+}
 
 func (r *InternalError) Error() string {
 	return "Internal Server Error"
 }
+
+func (r *InternalError) Unwrap() error { return r.Err }
+func (r *InternalError) Status() int   { return 500 }
+func (r *InternalError) Code() string  { return InternalErrorCode }
+func (r *InternalError) Title() string { return "Internal server error" }
+
+// Returned for transient failures that clients can retry after RetryAfter
+// seconds. Cause works like ConflictError's.
+type ServiceUnavailableError struct {
+	Err        error
+	RetryAfter int
+	Cause      error
+}
+
+func (r *ServiceUnavailableError) Error() string {
+	return r.Err.Error()
+}
+
+func (r *ServiceUnavailableError) Unwrap() error {
+	if r.Cause != nil {
+		return r.Cause
+	}
+	return r.Err
+}
+
+func (r *ServiceUnavailableError) Status() int   { return 503 }
+func (r *ServiceUnavailableError) Code() string  { return ServiceUnavailableCode }
+func (r *ServiceUnavailableError) Title() string { return "Service unavailable" }
+
+// Returned when the invocation ran out of time. Err is only kept for
+// logging.
+type GatewayTimeoutError struct {
+	Err error
+}
+
+func (r *GatewayTimeoutError) Error() string {
+	return "The request took too long to process."
+}
+
+func (r *GatewayTimeoutError) Unwrap() error { return r.Err }
+func (r *GatewayTimeoutError) Status() int   { return 504 }
+func (r *GatewayTimeoutError) Code() string  { return GatewayTimeoutCode }
+func (r *GatewayTimeoutError) Title() string { return "Gateway timeout" }
+
+type UnprocessableEntityError struct {
+	Err error
+}
+
+func (r *UnprocessableEntityError) Error() string {
+	return r.Err.Error()
+}
+
+func (r *UnprocessableEntityError) Unwrap() error { return r.Err }
+func (r *UnprocessableEntityError) Status() int   { return 422 }
+func (r *UnprocessableEntityError) Code() string  { return UnprocessableEntityCode }
+func (r *UnprocessableEntityError) Title() string { return "Unprocessable entity" }
+
+// Allowed lists the methods the resource does support
+type MethodNotAllowedError struct {
+	Err     error
+	Allowed []string
+}
+
+func (r *MethodNotAllowedError) Error() string {
+	return r.Err.Error()
+}
+
+func (r *MethodNotAllowedError) Unwrap() error { return r.Err }
+func (r *MethodNotAllowedError) Status() int   { return 405 }
+func (r *MethodNotAllowedError) Code() string  { return MethodNotAllowedCode }
+func (r *MethodNotAllowedError) Title() string { return "Method not allowed" }
@@ -0,0 +1,17 @@
+package types
+
+// Response stored for an Idempotency-Key so retries can be answered with it
+type IdempotentResponse struct {
+	StatusCode int    `dynamodbav:"statusCode"`
+	Body       string `dynamodbav:"body"`
+}
+
+type DdbIdempotencyItem struct {
+	Id          string `dynamodbav:"id"`
+	SecondaryId string `dynamodbav:"secondaryId"`
+	RequestHash string `dynamodbav:"requestHash"`
+	// Only set while the first request with the key is being processed
+	LockExpires int64               `dynamodbav:"lockExpires,omitempty"`
+	Response    *IdempotentResponse `dynamodbav:"response,omitempty"`
+	Ttl         int64               `dynamodbav:"ttl"`
+}
@@ -2,8 +2,43 @@ package types
 
 import (
 	"context"
-
-	"github.com/aws/aws-lambda-go/events"
+	"encoding/json"
 )
 
-type HandlerSignature func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+// Request is what handlers see regardless of which front end invoked the
+// Lambda. common.LambdaEventAdapter fills it from the raw event.
+type Request struct {
+	Method string
+	// Path as requested, e.g. /v1/entity/1234
+	Path string
+	// Matched route template, e.g. /v1/entity/{entityId}
+	Resource              string
+	Headers               map[string]string
+	MultiValueHeaders     map[string][]string
+	QueryStringParameters map[string]string
+	PathParameters        map[string]string
+	Cookies               []string `log:"sensitive"`
+	// Already decoded when the front end sent it base64 encoded
+	Body      string `log:"sensitive"`
+	RequestId string
+	// Context returned by a Lambda authorizer, including principalId for REST APIs
+	Authorizer map[string]interface{}
+	// Only set behind an HTTP API JWT authorizer
+	JwtClaims map[string]string
+	JwtScopes []string
+}
+
+type Response struct {
+	StatusCode        int
+	Headers           map[string]string
+	MultiValueHeaders map[string][]string
+	// Sent as Set-Cookie headers
+	Cookies         []string `log:"sensitive"`
+	Body            string   `log:"sensitive"`
+	IsBase64Encoded bool
+}
+
+type HandlerSignature func(ctx context.Context, request Request) (Response, error)
+
+// What lambda.Start is given, the response type depends on the event
+type LambdaEventHandlerSignature func(ctx context.Context, event json.RawMessage) (interface{}, error)